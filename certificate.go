@@ -3,6 +3,7 @@
 package webrtc
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
@@ -10,6 +11,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"math/big"
 	"time"
@@ -91,30 +93,138 @@ func (c Certificate) Expires() time.Time {
 	return c.x509Cert.NotAfter
 }
 
-// GetFingerprints returns the list of certificate fingerprints, one of which
-// is computed with the digest algorithm used in the certificate signature.
+// GetFingerprints returns the list of certificate fingerprints, one for
+// each of the SHA-2 hash functions announced in descriptions.
 func (c Certificate) GetFingerprints() ([]DTLSFingerprint, error) {
-	fingerprintAlgorithms := []dtls.HashAlgorithm{dtls.HashAlgorithmSHA256}
-	res := make([]DTLSFingerprint, len(fingerprintAlgorithms))
+	fingerprintAlgorithms := []dtls.HashAlgorithm{
+		dtls.HashAlgorithmSHA256,
+		dtls.HashAlgorithmSHA384,
+		dtls.HashAlgorithmSHA512,
+	}
+	res := make([]DTLSFingerprint, 0, len(fingerprintAlgorithms))
 
-	i := 0
 	for _, algo := range fingerprintAlgorithms {
 		value, err := dtls.Fingerprint(c.x509Cert, algo)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create fingerprint: %v", err)
 		}
-		res[i] = DTLSFingerprint{
+		res = append(res, DTLSFingerprint{
 			Algorithm: algo.String(),
 			Value:     value,
+		})
+	}
+
+	return res, nil
+}
+
+// CertificateFromX509 creates a Certificate from an x509.Certificate and
+// the private key it has been issued for.
+func CertificateFromX509(privateKey crypto.PrivateKey, certificate *x509.Certificate) (*Certificate, error) {
+	if certificate == nil {
+		return nil, &rtcerr.InvalidAccessError{Err: ErrCertificateMissing}
+	}
+
+	switch privateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, &rtcerr.NotSupportedError{Err: ErrPrivateKeyType}
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(privateKey.(crypto.Signer).Public())
+	if err != nil {
+		return nil, &rtcerr.UnknownError{Err: err}
+	}
+	if !bytes.Equal(publicKey, certificate.RawSubjectPublicKeyInfo) {
+		return nil, &rtcerr.InvalidAccessError{Err: ErrCertificateKeyMismatch}
+	}
+
+	return &Certificate{privateKey: privateKey, x509Cert: certificate}, nil
+}
+
+// CertificateFromPEM parses a Certificate from the PEM blocks of its x509
+// certificate and of its private key, in PKCS#8, PKCS#1 or SEC 1 form.
+// This is the reverse of Certificate.PEM.
+func CertificateFromPEM(pems string) (*Certificate, error) {
+	var certificate *x509.Certificate
+	var privateKey crypto.PrivateKey
+
+	rest := []byte(pems)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err = x509.ParseCertificate(block.Bytes)
+		case "PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			privateKey, err = x509.ParseECPrivateKey(block.Bytes)
 		}
+		if err != nil {
+			return nil, &rtcerr.SyntaxError{Err: err}
+		}
+	}
+
+	if certificate == nil || privateKey == nil {
+		return nil, &rtcerr.SyntaxError{Err: ErrCertificatePEMIncomplete}
+	}
+	return CertificateFromX509(privateKey, certificate)
+}
+
+// PEM returns the x509 certificate and the private key, as PKCS#8, of the
+// Certificate as PEM blocks. Stored and loaded back with CertificateFromPEM
+// it keeps the DTLS fingerprints stable across restarts.
+func (c Certificate) PEM() (string, error) {
+	if c.x509Cert == nil || c.privateKey == nil {
+		return "", &rtcerr.InvalidStateError{Err: ErrCertificatePEMIncomplete}
+	}
+
+	privateKey, err := x509.MarshalPKCS8PrivateKey(c.privateKey)
+	if err != nil {
+		return "", &rtcerr.UnknownError{Err: err}
 	}
 
-	return res[:i+1], nil
+	var pems bytes.Buffer
+	if err = pem.Encode(&pems, &pem.Block{Type: "CERTIFICATE", Bytes: c.x509Cert.Raw}); err != nil {
+		return "", &rtcerr.UnknownError{Err: err}
+	}
+	if err = pem.Encode(&pems, &pem.Block{Type: "PRIVATE KEY", Bytes: privateKey}); err != nil {
+		return "", &rtcerr.UnknownError{Err: err}
+	}
+	return pems.String(), nil
+}
+
+// X509Certificate returns the x509 certificate used for DTLS
+func (c Certificate) X509Certificate() *x509.Certificate {
+	return c.x509Cert
+}
+
+// PrivateKey returns the private key the certificate has been issued for
+func (c Certificate) PrivateKey() crypto.PrivateKey {
+	return c.privateKey
 }
 
 // GenerateCertificate causes the creation of an X.509 certificate and
-// corresponding private key.
+// corresponding private key. It is valid for a month.
 func GenerateCertificate(secretKey crypto.PrivateKey) (*Certificate, error) {
+	now := time.Now()
+	return generateCertificate(secretKey, now, now.AddDate(0, 1, 0))
+}
+
+// GenerateCertificateWithValidity is GenerateCertificate for a certificate
+// that is valid for the given duration.
+func GenerateCertificateWithValidity(secretKey crypto.PrivateKey, validity time.Duration) (*Certificate, error) {
+	now := time.Now()
+	return generateCertificate(secretKey, now, now.Add(validity))
+}
+
+func generateCertificate(secretKey crypto.PrivateKey, notBefore, notAfter time.Time) (*Certificate, error) {
 	origin := make([]byte, 16)
 	/* #nosec */
 	if _, err := rand.Read(origin); err != nil {
@@ -137,9 +247,9 @@ func GenerateCertificate(secretKey crypto.PrivateKey) (*Certificate, error) {
 			x509.ExtKeyUsageServerAuth,
 		},
 		BasicConstraintsValid: true,
-		NotBefore:             time.Now(),
+		NotBefore:             notBefore,
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		NotAfter:              time.Now().AddDate(0, 1, 0),
+		NotAfter:              notAfter,
 		SerialNumber:          serialNumber,
 		Version:               2,
 		Subject:               pkix.Name{CommonName: hex.EncodeToString(origin)},
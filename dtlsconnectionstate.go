@@ -0,0 +1,26 @@
+// +build !js
+
+package webrtc
+
+import (
+	"crypto/x509"
+
+	"github.com/pion/dtls"
+)
+
+// DTLSConnectionState describes the DTLS session a DTLSTransport
+// negotiated
+type DTLSConnectionState struct {
+	// Role is the DTLS role of the local end
+	Role DTLSRole
+
+	// CipherSuite is the cipher suite the ServerHello selected
+	CipherSuite dtls.CipherSuiteID
+
+	// SRTPProtectionProfile is the profile the use_srtp extension selected
+	SRTPProtectionProfile SRTPProtectionProfile
+
+	// RemoteCertificates is the certificate chain of the remote. pion/dtls
+	// only keeps the leaf certificate, which WebRTC endpoints self-sign.
+	RemoteCertificates []*x509.Certificate
+}
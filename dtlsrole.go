@@ -1,6 +1,7 @@
 package webrtc
 
 import (
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
 	"github.com/pion/sdp/v2"
 )
 
@@ -34,7 +35,8 @@ func (r DTLSRole) String() string {
 }
 
 // Iterate a SessionDescription from a remote to determine if an explicit
-// role can been determined for local connection. The decision is made from the first role we we parse.
+// role can been determined for local connection. The decision is made from the first role we we parse,
+// a=setup set at the session level applies to media sections that don't set their own.
 // If no role can be found we return DTLSRoleAuto
 func dtlsRoleFromRemoteSDP(sessionDescription *sdp.SessionDescription) DTLSRole {
 	if sessionDescription == nil {
@@ -42,19 +44,83 @@ func dtlsRoleFromRemoteSDP(sessionDescription *sdp.SessionDescription) DTLSRole
 	}
 
 	for _, mediaSection := range sessionDescription.MediaDescriptions {
-		for _, attribute := range mediaSection.Attributes {
-			if attribute.Key == "setup" {
-				switch attribute.Value {
-				case "active":
-					return DTLSRoleServer
-				case "passive":
-					return DTLSRoleClient
-				default:
-					return DTLSRoleAuto
-				}
-			}
+		if value, ok := mediaSection.Attribute(sdp.AttrKeyConnectionSetup); ok {
+			return dtlsRoleFromSetup(value)
 		}
 	}
 
-	return DTLSRoleAuto
+	value, _ := sessionDescription.Attribute(sdp.AttrKeyConnectionSetup)
+	return dtlsRoleFromSetup(value)
+}
+
+// dtlsRoleFromSetup returns the local DTLS role implied by the a=setup value
+// of the remote
+func dtlsRoleFromSetup(value string) DTLSRole {
+	switch value {
+	case sdp.ConnectionRoleActive.String():
+		return DTLSRoleServer
+	case sdp.ConnectionRolePassive.String():
+		return DTLSRoleClient
+	default:
+		return DTLSRoleAuto
+	}
+}
+
+// connectionRole returns the a=setup value announcing the DTLS role
+func (r DTLSRole) connectionRole() sdp.ConnectionRole {
+	switch r {
+	case DTLSRoleClient:
+		return sdp.ConnectionRoleActive
+	case DTLSRoleServer:
+		return sdp.ConnectionRolePassive
+	default:
+		return sdp.ConnectionRoleActpass
+	}
+}
+
+// mediaSetup returns the a=setup value of a media section, or else the one
+// set at the session level
+func mediaSetup(desc *sdp.SessionDescription, m *sdp.MediaDescription) string {
+	if value, ok := m.Attribute(sdp.AttrKeyConnectionSetup); ok {
+		return value
+	}
+	value, _ := desc.Attribute(sdp.AttrKeyConnectionSetup)
+	return value
+}
+
+// reverse returns the role of the other end
+func (r DTLSRole) reverse() DTLSRole {
+	switch r {
+	case DTLSRoleClient:
+		return DTLSRoleServer
+	case DTLSRoleServer:
+		return DTLSRoleClient
+	default:
+		return r
+	}
+}
+
+// validateDTLSSetup checks the a=setup values of a remote description. An
+// offer may leave the choice of the role to the answerer, an answer has to
+// take one. Once negotiated is not DTLSRoleAuto the DTLS association is up
+// with that local role, and the remote can't take the same role again.
+func validateDTLSSetup(remote *sdp.SessionDescription, isAnswer bool, negotiated DTLSRole) error {
+	for _, m := range remote.MediaDescriptions {
+		switch value := mediaSetup(remote, m); value {
+		case "":
+			// Legacy endpoints don't announce a role, it is derived from
+			// the ICE role
+		case sdp.ConnectionRoleActive.String(), sdp.ConnectionRolePassive.String():
+			if negotiated != DTLSRoleAuto && dtlsRoleFromSetup(value) != negotiated {
+				return &rtcerr.InvalidAccessError{Err: ErrInvalidDTLSSetup}
+			}
+		case sdp.ConnectionRoleActpass.String():
+			if isAnswer {
+				return &rtcerr.InvalidAccessError{Err: ErrInvalidDTLSSetup}
+			}
+		default:
+			return &rtcerr.InvalidAccessError{Err: ErrInvalidDTLSSetup}
+		}
+	}
+	return nil
 }
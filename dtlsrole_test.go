@@ -58,6 +58,15 @@ t=0 0
 m=application 47299 DTLS/SCTP 5000
 c=IN IP4 192.168.20.129
 a=setup:%s
+`
+
+	const sessionSetupDeclared = `v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+a=setup:%s
+m=application 47299 DTLS/SCTP 5000
+c=IN IP4 192.168.20.129
 `
 
 	testCases := []struct {
@@ -71,6 +80,7 @@ a=setup:%s
 		{"MediaDescription, setup:actpass", parseSDP(fmt.Sprintf(mediaSetupDeclared, "actpass")), DTLSRoleAuto},
 		{"MediaDescription, setup:passive", parseSDP(fmt.Sprintf(mediaSetupDeclared, "passive")), DTLSRoleClient},
 		{"MediaDescription, setup:active", parseSDP(fmt.Sprintf(mediaSetupDeclared, "active")), DTLSRoleServer},
+		{"SessionDescription, setup:passive", parseSDP(fmt.Sprintf(sessionSetupDeclared, "passive")), DTLSRoleClient},
 	}
 	for _, testCase := range testCases {
 		assert.Equal(t,
@@ -80,3 +90,55 @@ a=setup:%s
 		)
 	}
 }
+
+func TestValidateDTLSSetup(t *testing.T) {
+	parseSDP := func(setup string) *sdp.SessionDescription {
+		raw := `v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+m=application 47299 DTLS/SCTP 5000
+c=IN IP4 192.168.20.129
+`
+		if setup != "" {
+			raw += "a=setup:" + setup + "\n"
+		}
+
+		parsed := &sdp.SessionDescription{}
+		if err := parsed.Unmarshal([]byte(raw)); err != nil {
+			panic(err)
+		}
+		return parsed
+	}
+
+	testCases := []struct {
+		test       string
+		remote     string
+		isAnswer   bool
+		negotiated DTLSRole
+		valid      bool
+	}{
+		{"Offer, setup:actpass", "actpass", false, DTLSRoleAuto, true},
+		{"Offer, setup:active", "active", false, DTLSRoleAuto, true},
+		{"Offer, no setup", "", false, DTLSRoleAuto, true},
+		{"Offer, setup:holdconn", "holdconn", false, DTLSRoleAuto, false},
+		{"Answer, setup:active", "active", true, DTLSRoleAuto, true},
+		{"Answer, setup:passive", "passive", true, DTLSRoleAuto, true},
+		{"Answer, setup:actpass", "actpass", true, DTLSRoleAuto, false},
+		{"Answer, no setup", "", true, DTLSRoleAuto, true},
+		{"Renegotiated offer, setup:actpass", "actpass", false, DTLSRoleClient, true},
+		{"Renegotiated offer, keeps the role", "passive", false, DTLSRoleClient, true},
+		{"Renegotiated offer, swaps the role", "active", false, DTLSRoleClient, false},
+		{"Renegotiated answer, keeps the role", "active", true, DTLSRoleServer, true},
+		{"Renegotiated answer, swaps the role", "passive", true, DTLSRoleServer, false},
+		{"Renegotiated answer, setup:actpass", "actpass", true, DTLSRoleServer, false},
+	}
+	for _, testCase := range testCases {
+		err := validateDTLSSetup(parseSDP(testCase.remote), testCase.isAnswer, testCase.negotiated)
+		if testCase.valid {
+			assert.NoError(t, err, "TestValidateDTLSSetup (%s)", testCase.test)
+		} else {
+			assert.Error(t, err, "TestValidateDTLSSetup (%s)", testCase.test)
+		}
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/dtls"
@@ -32,13 +35,18 @@ type DTLSTransport struct {
 	remoteParameters  DTLSParameters
 	remoteCertificate []byte
 	state             DTLSTransportState
+	role              DTLSRole
+
+	srtpProtectionProfile SRTPProtectionProfile
+	cipherSuite           dtls.CipherSuiteID
 
 	onStateChangeHdlr func(DTLSTransportState)
+	onErrorHdlr       func(error)
 
 	conn *dtls.Conn
 
-	srtpSession   *srtp.SessionSRTP
-	srtcpSession  *srtp.SessionSRTCP
+	srtpSession   rtpSession
+	srtcpSession  rtcpSession
 	srtpEndpoint  *mux.Endpoint
 	srtcpEndpoint *mux.Endpoint
 
@@ -55,6 +63,7 @@ func (api *API) NewDTLSTransport(transport *ICETransport, certificates []Certifi
 		iceTransport: transport,
 		api:          api,
 		state:        DTLSTransportStateNew,
+		role:         DTLSRoleAuto,
 		dtlsMatcher:  mux.MatchDTLS,
 	}
 
@@ -106,6 +115,23 @@ func (t *DTLSTransport) OnStateChange(f func(DTLSTransportState)) {
 	t.onStateChangeHdlr = f
 }
 
+// onError requires the caller holds the lock
+func (t *DTLSTransport) onError(err error) {
+	hdlr := t.onErrorHdlr
+	if hdlr != nil {
+		hdlr(err)
+	}
+}
+
+// OnError sets a handler that is fired when the DTLS handshake fails, or
+// when the remote certificate is rejected. ErrNoRemoteCertificate and
+// ErrNoMatchingFingerprint tell why the certificate has been rejected.
+func (t *DTLSTransport) OnError(f func(error)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onErrorHdlr = f
+}
+
 // State returns the current dtls transport state.
 func (t *DTLSTransport) State() DTLSTransportState {
 	t.lock.RLock()
@@ -140,18 +166,78 @@ func (t *DTLSTransport) GetRemoteCertificate() []byte {
 	return t.remoteCertificate
 }
 
+// ConnectionState returns the details of the DTLS session, once the
+// handshake has completed
+func (t *DTLSTransport) ConnectionState() (DTLSConnectionState, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.conn == nil {
+		return DTLSConnectionState{}, &rtcerr.InvalidStateError{Err: ErrDTLSTransportNotConnected}
+	}
+
+	state := DTLSConnectionState{
+		Role:                  t.role,
+		CipherSuite:           t.cipherSuite,
+		SRTPProtectionProfile: t.srtpProtectionProfile,
+		RemoteCertificates:    []*x509.Certificate{},
+	}
+	if remoteCert := t.conn.RemoteCertificate(); remoteCert != nil {
+		state.RemoteCertificates = append(state.RemoteCertificates, remoteCert)
+	}
+	return state, nil
+}
+
+// ExportKeyingMaterial derives keying material from the DTLS session as
+// described in https://tools.ietf.org/html/rfc5705. The SRTP keys are
+// derived with the "EXTRACTOR-dtls_srtp" label.
+// https://tools.ietf.org/html/rfc5764#section-4.2
+func (t *DTLSTransport) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.conn == nil {
+		return nil, &rtcerr.InvalidStateError{Err: ErrDTLSTransportNotConnected}
+	}
+	return t.conn.ExportKeyingMaterial(label, context, length)
+}
+
+// Role returns the DTLS role the DTLSTransport negotiated, DTLSRoleClient or
+// DTLSRoleServer. It is DTLSRoleAuto until the DTLSTransport is started.
+func (t *DTLSTransport) Role() DTLSRole {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.role
+}
+
 func (t *DTLSTransport) startSRTP() error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
 	if t.srtpSession != nil && t.srtcpSession != nil {
 		return nil
-	} else if t.conn == nil {
+	}
+
+	if t.api.settingEngine.insecurePlainRTP {
+		if t.srtpEndpoint == nil || t.srtcpEndpoint == nil {
+			return fmt.Errorf("the DTLS transport has not started yet")
+		}
+		log := t.api.settingEngine.LoggerFactory.NewLogger("webrtc")
+		t.srtpSession = newPlainRTPSession(t.srtpEndpoint, log)
+		t.srtcpSession = newPlainRTCPSession(t.srtcpEndpoint, log)
+		return nil
+	}
+
+	if t.conn == nil {
 		return fmt.Errorf("the DTLS transport has not started yet")
 	}
 
+	if t.srtpProtectionProfile == 0 {
+		return ErrNoSRTPProtectionProfile
+	}
+
 	srtpConfig := &srtp.Config{
-		Profile:       srtp.ProtectionProfileAes128CmHmacSha1_80,
+		Profile:       t.srtpProtectionProfile.srtpProfile(),
 		LoggerFactory: t.api.settingEngine.LoggerFactory,
 	}
 
@@ -170,12 +256,12 @@ func (t *DTLSTransport) startSRTP() error {
 		return fmt.Errorf("failed to start srtp: %v", err)
 	}
 
-	t.srtpSession = srtpSession
-	t.srtcpSession = srtcpSession
+	t.srtpSession = secureRTPSession{srtpSession}
+	t.srtcpSession = secureRTCPSession{srtcpSession}
 	return nil
 }
 
-func (t *DTLSTransport) getSRTPSession() (*srtp.SessionSRTP, error) {
+func (t *DTLSTransport) getSRTPSession() (rtpSession, error) {
 	t.lock.RLock()
 	if t.srtpSession != nil {
 		t.lock.RUnlock()
@@ -190,7 +276,7 @@ func (t *DTLSTransport) getSRTPSession() (*srtp.SessionSRTP, error) {
 	return t.srtpSession, nil
 }
 
-func (t *DTLSTransport) getSRTCPSession() (*srtp.SessionSRTCP, error) {
+func (t *DTLSTransport) getSRTCPSession() (rtcpSession, error) {
 	t.lock.RLock()
 	if t.srtcpSession != nil {
 		t.lock.RUnlock()
@@ -205,6 +291,15 @@ func (t *DTLSTransport) getSRTCPSession() (*srtp.SessionSRTCP, error) {
 	return t.srtcpSession, nil
 }
 
+// srtpProtectionProfiles returns the SRTP protection profiles offered in
+// the DTLS handshake
+func (t *DTLSTransport) srtpProtectionProfiles() []SRTPProtectionProfile {
+	if len(t.api.settingEngine.srtpProtectionProfiles) != 0 {
+		return t.api.settingEngine.srtpProtectionProfiles
+	}
+	return defaultSRTPProtectionProfiles()
+}
+
 func (t *DTLSTransport) isClient() bool {
 	isClient := true
 	switch t.remoteParameters.Role {
@@ -234,50 +329,119 @@ func (t *DTLSTransport) Start(remoteParameters DTLSParameters) error {
 		return &rtcerr.InvalidStateError{Err: fmt.Errorf("attempted to start DTLSTransport that is not in new state: %s", t.state)}
 	}
 
-	dtlsEndpoint := t.iceTransport.NewEndpoint(mux.MatchDTLS)
+	t.remoteParameters = remoteParameters
+	t.role = DTLSRoleServer
+	if t.isClient() {
+		t.role = DTLSRoleClient
+	}
+
 	t.srtpEndpoint = t.iceTransport.NewEndpoint(mux.MatchSRTP)
 	t.srtcpEndpoint = t.iceTransport.NewEndpoint(mux.MatchSRTCP)
 
-	// pion/webrtc#753
-	cert := t.certificates[0]
+	// Without DTLS media flows in the clear as soon as ICE is connected
+	if t.api.settingEngine.insecurePlainRTP {
+		t.onStateChange(DTLSTransportStateConnected)
+		return nil
+	}
+
+	dtlsEndpoint := t.iceTransport.NewEndpoint(mux.MatchDTLS)
+
+	t.onStateChange(DTLSTransportStateConnecting)
+
+	// pion/dtls takes a single certificate and refuses private keys that
+	// aren't ECDSA. Its server also always picks the first cipher suite of
+	// the ClientHello, so it couldn't switch to an RSA suite either. The
+	// other certificates are announced, but the handshake always uses the
+	// first ECDSA one.
+	var handshakeConn net.Conn = dtlsEndpoint
+	cert, err := selectCertificate(t.certificates)
+	if err != nil {
+		return t.fail(err)
+	}
+
+	// pion/dtls doesn't expose the cipher suite it negotiated
+	helloConn := &serverHelloConn{Conn: handshakeConn}
+	handshakeConn = helloConn
+
+	srtpProtectionProfiles := []dtls.SRTPProtectionProfile{}
+	for _, profile := range t.srtpProtectionProfiles() {
+		srtpProtectionProfiles = append(srtpProtectionProfiles, profile.dtlsProfile())
+	}
 
 	dtlsCofig := &dtls.Config{
 		Certificate:            cert.x509Cert,
 		PrivateKey:             cert.privateKey,
-		SRTPProtectionProfiles: []dtls.SRTPProtectionProfile{dtls.SRTP_AES128_CM_HMAC_SHA1_80},
+		SRTPProtectionProfiles: srtpProtectionProfiles,
 		ClientAuth:             dtls.RequireAnyClientCert,
 		LoggerFactory:          t.api.settingEngine.LoggerFactory,
 		InsecureSkipVerify:     true,
 	}
 
-	t.onStateChange(DTLSTransportStateConnecting)
 	if t.isClient() {
 		// Assumes the peer offered to be passive and we accepted.
-		dtlsConn, err := dtls.Client(dtlsEndpoint, dtlsCofig)
+		dtlsConn, err := dtls.Client(handshakeConn, dtlsCofig)
 		if err != nil {
-			t.onStateChange(DTLSTransportStateFailed)
-			return err
+			return t.fail(err)
 		}
 		t.conn = dtlsConn
 	} else {
 		// Assumes we offer to be passive and this is accepted.
-		dtlsConn, err := dtls.Server(dtlsEndpoint, dtlsCofig)
+		dtlsConn, err := dtls.Server(handshakeConn, dtlsCofig)
 		if err != nil {
-			t.onStateChange(DTLSTransportStateFailed)
-			return err
+			return t.fail(err)
 		}
 		t.conn = dtlsConn
 	}
-	t.onStateChange(DTLSTransportStateConnected)
+	if profile, ok := t.conn.SelectedSRTPProtectionProfile(); ok {
+		t.srtpProtectionProfile = SRTPProtectionProfile(profile)
+	}
+	t.cipherSuite = helloConn.selectedCipherSuite()
 
-	// Check the fingerprint if a certificate was exchanged
+	// The remote is only authenticated once its certificate matches one of
+	// the fingerprints it announced, nothing may use the connection before
 	remoteCert := t.conn.RemoteCertificate()
 	if remoteCert == nil {
-		return fmt.Errorf("peer didn't provide certificate via DTLS")
+		return t.fail(ErrNoRemoteCertificate)
 	}
 
 	t.remoteCertificate = remoteCert.Raw
-	return t.validateFingerPrint(remoteParameters, remoteCert)
+	if err := t.validateFingerPrint(remoteParameters, remoteCert); err != nil {
+		return t.fail(err)
+	}
+	if verify := t.api.settingEngine.dtlsVerifyPeerCertificate; verify != nil {
+		if err := verify(remoteCert); err != nil {
+			return t.fail(err)
+		}
+	}
+
+	t.onStateChange(DTLSTransportStateConnected)
+	return nil
+}
+
+// fail closes the DTLS connection and moves to the failed state, it
+// requires the caller holds the lock
+func (t *DTLSTransport) fail(err error) error {
+	if t.conn != nil {
+		// The connection is discarded whether it closes cleanly or not
+		conn := t.conn
+		conn.Close() // nolint:errcheck
+		t.conn = nil
+
+		// pion/dtls blocks delivering application data that arrived
+		// before the failure until it is read, even once closed. Drain it
+		// so its read loop can exit.
+		go func() {
+			b := make([]byte, receiveMTU)
+			for {
+				if _, err := conn.Read(b); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	t.onStateChange(DTLSTransportStateFailed)
+	t.onError(err)
+	return err
 }
 
 // Stop stops and closes the DTLSTransport object.
@@ -309,11 +473,14 @@ func (t *DTLSTransport) Stop() error {
 	return util.FlattenErrs(closeErrs)
 }
 
+// validateFingerPrint checks that the remote certificate matches any of the
+// fingerprints the remote announced, the ones using a hash function we don't
+// know are ignored
 func (t *DTLSTransport) validateFingerPrint(remoteParameters DTLSParameters, remoteCert *x509.Certificate) error {
 	for _, fp := range remoteParameters.Fingerprints {
-		hashAlgo, err := dtls.HashAlgorithmString(fp.Algorithm)
+		hashAlgo, err := dtls.HashAlgorithmString(strings.ToLower(fp.Algorithm))
 		if err != nil {
-			return err
+			continue
 		}
 
 		remoteValue, err := dtls.Fingerprint(remoteCert, hashAlgo)
@@ -326,7 +493,7 @@ func (t *DTLSTransport) validateFingerPrint(remoteParameters DTLSParameters, rem
 		}
 	}
 
-	return errors.New("no matching fingerprint")
+	return ErrNoMatchingFingerprint
 }
 
 func (t *DTLSTransport) ensureICEConn() error {
@@ -337,3 +504,85 @@ func (t *DTLSTransport) ensureICEConn() error {
 
 	return nil
 }
+
+const (
+	dtlsRecordHeaderLength       = 13
+	dtlsHandshakeHeaderLength    = 12
+	dtlsContentTypeHandshake     = 22
+	dtlsHandshakeTypeServerHello = 2
+)
+
+// selectCertificate returns the first certificate pion/dtls can use, it
+// only accepts ECDSA keys
+func selectCertificate(certificates []Certificate) (Certificate, error) {
+	for _, c := range certificates {
+		if _, ok := c.privateKey.(*ecdsa.PrivateKey); ok {
+			return c, nil
+		}
+	}
+	return Certificate{}, ErrNoECDSACertificate
+}
+
+// serverHelloCipherSuite returns the cipher suite selected by a ServerHello
+// among the records of a DTLS datagram. ok is false if there is none.
+func serverHelloCipherSuite(packet []byte) (cipherSuite dtls.CipherSuiteID, ok bool) {
+	for len(packet) >= dtlsRecordHeaderLength {
+		header := packet[:dtlsRecordHeaderLength]
+		recordLength := int(binary.BigEndian.Uint16(header[dtlsRecordHeaderLength-2:]))
+		if dtlsRecordHeaderLength+recordLength > len(packet) {
+			return 0, false
+		}
+		record := packet[dtlsRecordHeaderLength : dtlsRecordHeaderLength+recordLength]
+		packet = packet[dtlsRecordHeaderLength+recordLength:]
+
+		// Only the handshake messages of epoch 0 are in the clear
+		epoch := binary.BigEndian.Uint16(header[3:])
+		if header[0] != dtlsContentTypeHandshake || epoch != 0 ||
+			len(record) < dtlsHandshakeHeaderLength || record[0] != dtlsHandshakeTypeServerHello {
+			continue
+		}
+		body := record[dtlsHandshakeHeaderLength:]
+
+		// server_version and random, then session_id
+		offset := 2 + 32
+		if offset >= len(body) {
+			return 0, false
+		}
+		offset += 1 + int(body[offset])
+		if offset+2 > len(body) {
+			return 0, false
+		}
+		return dtls.CipherSuiteID(binary.BigEndian.Uint16(body[offset:])), true
+	}
+	return 0, false
+}
+
+// serverHelloConn records the cipher suite of the ServerHello it carries,
+// which the server writes and the client reads
+type serverHelloConn struct {
+	net.Conn
+	cipherSuite uint32
+}
+
+func (c *serverHelloConn) observe(packet []byte) {
+	if cipherSuite, ok := serverHelloCipherSuite(packet); ok {
+		atomic.StoreUint32(&c.cipherSuite, uint32(cipherSuite))
+	}
+}
+
+func (c *serverHelloConn) selectedCipherSuite() dtls.CipherSuiteID {
+	return dtls.CipherSuiteID(atomic.LoadUint32(&c.cipherSuite))
+}
+
+func (c *serverHelloConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err == nil {
+		c.observe(p[:n])
+	}
+	return n, err
+}
+
+func (c *serverHelloConn) Write(p []byte) (int, error) {
+	c.observe(p)
+	return c.Conn.Write(p)
+}
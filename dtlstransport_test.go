@@ -0,0 +1,120 @@
+// +build !js
+
+package webrtc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+)
+
+// newClientHello builds a DTLS record carrying a ClientHello, extensions
+// are left out when nil
+func newClientHello(extensions []byte) []byte {
+	body := []byte{0xfe, 0xfd}               // client_version
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0, 0)                // session_id, cookie
+	body = append(body, 0, 2, 0xc0, 0x2b)    // cipher_suites
+	body = append(body, 1, 0)                // compression_methods
+	if extensions != nil {
+		body = append(body, byte(len(extensions)>>8), byte(len(extensions)))
+		body = append(body, extensions...)
+	}
+
+	length := []byte{byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	handshake := []byte{1} // client_hello
+	handshake = append(handshake, length...)
+	handshake = append(handshake, 0, 0, 0, 0, 0) // message_seq, fragment_offset
+	handshake = append(handshake, length...)
+	handshake = append(handshake, body...)
+
+	record := []byte{dtlsContentTypeHandshake, 0xfe, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}
+	record = append(record, byte(len(handshake)>>8), byte(len(handshake)))
+	return append(record, handshake...)
+}
+
+// newServerHello builds a DTLS record of the given epoch carrying a
+// ServerHello that selects cipherSuite
+func newServerHello(epoch byte, cipherSuite dtls.CipherSuiteID) []byte {
+	body := []byte{0xfe, 0xfd}               // server_version
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session_id
+	body = append(body, byte(cipherSuite>>8), byte(cipherSuite))
+	body = append(body, 0) // compression_method
+
+	length := []byte{byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	handshake := []byte{dtlsHandshakeTypeServerHello}
+	handshake = append(handshake, length...)
+	handshake = append(handshake, 0, 0, 0, 0, 0) // message_seq, fragment_offset
+	handshake = append(handshake, length...)
+	handshake = append(handshake, body...)
+
+	record := []byte{dtlsContentTypeHandshake, 0xfe, 0xfd, 0, epoch, 0, 0, 0, 0, 0, 0}
+	record = append(record, byte(len(handshake)>>8), byte(len(handshake)))
+	return append(record, handshake...)
+}
+
+func TestServerHelloCipherSuite(t *testing.T) {
+	for _, testCase := range []struct {
+		packet   []byte
+		ok       bool
+		expected dtls.CipherSuiteID
+	}{
+		{newServerHello(0, dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), true, dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		// The ServerHello follows another record in the same datagram
+		{append(newClientHello(nil), newServerHello(0, dtls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)...), true, dtls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		{newServerHello(1, dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), false, 0},
+		{newClientHello(nil), false, 0},
+		{newServerHello(0, dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)[:20], false, 0},
+	} {
+		cipherSuite, ok := serverHelloCipherSuite(testCase.packet)
+		assert.Equal(t, testCase.ok, ok)
+		assert.Equal(t, testCase.expected, cipherSuite)
+	}
+}
+
+func TestSelectCertificate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaCertificate, err := GenerateCertificate(rsaKey)
+	assert.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ecdsaCertificate, err := GenerateCertificate(ecdsaKey)
+	assert.NoError(t, err)
+
+	// pion/dtls doesn't accept the RSA certificate
+	certificate, err := selectCertificate([]Certificate{*rsaCertificate, *ecdsaCertificate})
+	assert.NoError(t, err)
+	assert.True(t, ecdsaCertificate.Equals(certificate))
+
+	_, err = selectCertificate([]Certificate{*rsaCertificate})
+	assert.Equal(t, ErrNoECDSACertificate, err)
+}
+
+func TestDTLSTransport_ValidateFingerPrint(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	certificate, err := GenerateCertificate(sk)
+	assert.NoError(t, err)
+
+	sha1, err := dtls.Fingerprint(certificate.x509Cert, dtls.HashAlgorithmSHA1)
+	assert.NoError(t, err)
+
+	transport := &DTLSTransport{}
+	assert.NoError(t, transport.validateFingerPrint(DTLSParameters{Fingerprints: []DTLSFingerprint{
+		{Algorithm: "unknown", Value: "00:11"},
+		{Algorithm: "SHA-1", Value: strings.ToUpper(sha1)},
+	}}, certificate.x509Cert), "any fingerprint may match, whatever its case")
+
+	assert.Equal(t, ErrNoMatchingFingerprint, transport.validateFingerPrint(DTLSParameters{Fingerprints: []DTLSFingerprint{
+		{Algorithm: "sha-1", Value: "00:11"},
+	}}, certificate.x509Cert))
+}
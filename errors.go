@@ -83,4 +83,74 @@ var (
 	// ErrIncorrectSDPSemantics indicates that the PeerConnection was configured to
 	// generate SDP Answers with different SDP Semantics than the received Offer
 	ErrIncorrectSDPSemantics = errors.New("offer SDP semantics does not match configuration")
+
+	// ErrSenderNotCreatedByConnection indicates that an RTPSender was passed
+	// to a PeerConnection which didn't create it
+	ErrSenderNotCreatedByConnection = errors.New("RTPSender not created by this PeerConnection")
+
+	// ErrUnknownIdentityProvider indicates that no IdentityProvider has been
+	// registered for a domain
+	ErrUnknownIdentityProvider = errors.New("no identity provider registered for domain")
+
+	// ErrIdentityValidationFailed indicates that the identity assertion of
+	// the remote description couldn't be validated
+	ErrIdentityValidationFailed = errors.New("identity assertion validation failed")
+
+	// ErrPeerIdentityMismatch indicates that the remote peer didn't assert
+	// the identity required by PeerIdentity, or changed its identity
+	ErrPeerIdentityMismatch = errors.New("peer identity mismatch")
+
+	// ErrCandidateMediaNotFound indicates that a remote candidate refers to
+	// a media section the remote description doesn't have
+	ErrCandidateMediaNotFound = errors.New("no media section matches the candidate sdpMid or sdpMLineIndex")
+
+	// ErrCertificatePEMIncomplete indicates that PEM encoded data lacks
+	// either the x509 certificate or its private key
+	ErrCertificatePEMIncomplete = errors.New("PEM must hold both a certificate and its private key")
+
+	// ErrCertificateMissing indicates that no x509 certificate has been
+	// given for a private key
+	ErrCertificateMissing = errors.New("missing x509 certificate")
+
+	// ErrCertificateKeyMismatch indicates that a private key isn't the one a
+	// certificate has been issued for
+	ErrCertificateKeyMismatch = errors.New("private key doesn't match the certificate")
+
+	// ErrInvalidDTLSSetup indicates that the a=setup of a remote description
+	// is unknown, leaves the DTLS role open in an answer, or takes the same
+	// role as the offer
+	ErrInvalidDTLSSetup = errors.New("invalid or conflicting a=setup")
+
+	// ErrInvalidAnsweringDTLSRole indicates that the answering DTLS role is
+	// neither DTLSRoleClient nor DTLSRoleServer
+	ErrInvalidAnsweringDTLSRole = errors.New("answering DTLS role must be client or server")
+
+	// ErrUnsupportedSRTPProtectionProfile indicates that an SRTP protection
+	// profile isn't implemented by the DTLS and SRTP stacks
+	ErrUnsupportedSRTPProtectionProfile = errors.New("unsupported SRTP protection profile")
+
+	// ErrNoSRTPProtectionProfile indicates that no SRTP protection profile
+	// has been given, or that the DTLS handshake didn't negotiate one
+	ErrNoSRTPProtectionProfile = errors.New("no SRTP protection profile")
+
+	// ErrDTLSTransportNotConnected indicates that the DTLS handshake of a
+	// DTLSTransport hasn't completed
+	ErrDTLSTransportNotConnected = errors.New("DTLS transport not connected")
+
+	// ErrNoRemoteCertificate indicates that the remote didn't present a
+	// certificate during the DTLS handshake
+	ErrNoRemoteCertificate = errors.New("peer didn't provide certificate via DTLS")
+
+	// ErrNoECDSACertificate indicates that none of the certificates can be
+	// used by the DTLS handshake, which only accepts ECDSA keys
+	ErrNoECDSACertificate = errors.New("no ECDSA certificate for DTLS")
+
+	// ErrNoMatchingFingerprint indicates that the certificate the remote
+	// presented during the DTLS handshake doesn't match any of the
+	// fingerprints of its description
+	ErrNoMatchingFingerprint = errors.New("no matching fingerprint")
+
+	// ErrDataChannelsUnavailable indicates that data channels can't be
+	// created as SettingEngine.SetInsecurePlainRTP disabled DTLS
+	ErrDataChannelsUnavailable = errors.New("data channels are unavailable without DTLS")
 )
@@ -19,6 +19,10 @@ type ICECandidate struct {
 	Component      uint16           `json:"component"`
 	RelatedAddress string           `json:"relatedAddress"`
 	RelatedPort    uint16           `json:"relatedPort"`
+
+	// m-section of the local description the candidate has been gathered for
+	sdpMid        string
+	sdpMLineIndex uint16
 }
 
 // Conversion for package ice
@@ -156,9 +160,14 @@ func iceCandidateToSDP(c ICECandidate) sdp.ICECandidate {
 // ToJSON returns an ICECandidateInit
 // as indicated by the spec https://w3c.github.io/webrtc-pc/#dom-rtcicecandidate-tojson
 func (c ICECandidate) ToJSON() ICECandidateInit {
-	var sdpmLineIndex uint16
-	return ICECandidateInit{
+	sdpmLineIndex := c.sdpMLineIndex
+	init := ICECandidateInit{
 		Candidate:     fmt.Sprintf("candidate:%s", iceCandidateToSDP(c).Marshal()),
 		SDPMLineIndex: &sdpmLineIndex,
 	}
+	if c.sdpMid != "" {
+		sdpMid := c.sdpMid
+		init.SDPMid = &sdpMid
+	}
+	return init
 }
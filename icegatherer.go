@@ -21,6 +21,7 @@ type ICEGatherer struct {
 	validatedServers []*ice.URL
 
 	agentIsTrickle bool
+	agentIsLite    bool
 	agent          *ice.Agent
 
 	portMin                   uint16
@@ -39,6 +40,16 @@ type ICEGatherer struct {
 
 	onLocalCandidateHdlr func(candidate *ICECandidate)
 	onStateChangeHdlr    func(state ICEGathererState)
+
+	// Candidates gathered ahead of time are held in the pool until
+	// releasePool is called
+	poolLock sync.Mutex
+	pooling  bool
+	pool     []*ICECandidate
+
+	// m-section of the local description candidates are gathered for
+	sdpMid        string
+	sdpMLineIndex uint16
 }
 
 // NewICEGatherer creates a new NewICEGatherer.
@@ -54,23 +65,13 @@ func NewICEGatherer(
 	relayAcceptanceMinWait *time.Duration,
 	loggerFactory logging.LoggerFactory,
 	agentIsTrickle bool,
+	agentIsLite bool,
 	networkTypes []NetworkType,
 	opts ICEGatherOptions,
 ) (*ICEGatherer, error) {
-	var validatedServers []*ice.URL
-	if len(opts.ICEServers) > 0 {
-		for _, server := range opts.ICEServers {
-			url, err := server.urls()
-			if err != nil {
-				return nil, err
-			}
-			validatedServers = append(validatedServers, url...)
-		}
-	}
-
-	candidateTypes := []ice.CandidateType{}
-	if opts.ICEGatherPolicy == ICETransportPolicyRelay {
-		candidateTypes = append(candidateTypes, ice.CandidateTypeRelay)
+	validatedServers, candidateTypes, err := iceGatherURLsAndTypes(opts, agentIsLite)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ICEGatherer{
@@ -83,6 +84,7 @@ func NewICEGatherer(
 		loggerFactory:             loggerFactory,
 		log:                       loggerFactory.NewLogger("ice"),
 		agentIsTrickle:            agentIsTrickle,
+		agentIsLite:               agentIsLite,
 		networkTypes:              networkTypes,
 		candidateTypes:            candidateTypes,
 		candidateSelectionTimeout: candidateSelectionTimeout,
@@ -103,6 +105,7 @@ func (g *ICEGatherer) createAgent() error {
 
 	config := &ice.AgentConfig{
 		Trickle:                   g.agentIsTrickle,
+		Lite:                      g.agentIsLite,
 		Urls:                      g.validatedServers,
 		PortMin:                   g.portMin,
 		PortMax:                   g.portMax,
@@ -139,6 +142,31 @@ func (g *ICEGatherer) createAgent() error {
 	return nil
 }
 
+// iceGatherURLsAndTypes validates the ICE servers of opts and returns the
+// URLs and candidate types an agent gathers with
+func iceGatherURLsAndTypes(opts ICEGatherOptions, agentIsLite bool) ([]*ice.URL, []ice.CandidateType, error) {
+	var validatedServers []*ice.URL
+	for _, server := range opts.ICEServers {
+		url, err := server.urls()
+		if err != nil {
+			return nil, nil, err
+		}
+		validatedServers = append(validatedServers, url...)
+	}
+
+	// A lite agent only has host candidates (RFC 8445 2.5), the ICE
+	// servers and the gather policy don't apply to it
+	if agentIsLite {
+		return nil, []ice.CandidateType{ice.CandidateTypeHost}, nil
+	}
+
+	candidateTypes := []ice.CandidateType{}
+	if opts.ICEGatherPolicy == ICETransportPolicyRelay {
+		candidateTypes = append(candidateTypes, ice.CandidateTypeRelay)
+	}
+	return validatedServers, candidateTypes, nil
+}
+
 // Gather ICE candidates.
 func (g *ICEGatherer) Gather() error {
 	if err := g.createAgent(); err != nil {
@@ -146,11 +174,6 @@ func (g *ICEGatherer) Gather() error {
 	}
 
 	g.lock.Lock()
-	onLocalCandidateHdlr := g.onLocalCandidateHdlr
-	if onLocalCandidateHdlr == nil {
-		onLocalCandidateHdlr = func(*ICECandidate) {}
-	}
-
 	isTrickle := g.agentIsTrickle
 	agent := g.agent
 	g.lock.Unlock()
@@ -167,10 +190,10 @@ func (g *ICEGatherer) Gather() error {
 				g.log.Warnf("Failed to convert ice.Candidate: %s", err)
 				return
 			}
-			onLocalCandidateHdlr(&c)
+			g.onLocalCandidate(&c)
 		} else {
 			g.setState(ICEGathererStateComplete)
-			onLocalCandidateHdlr(nil)
+			g.onLocalCandidate(nil)
 		}
 	}); err != nil {
 		return err
@@ -178,6 +201,101 @@ func (g *ICEGatherer) Gather() error {
 	return agent.GatherCandidates()
 }
 
+// gatherPool starts gathering ahead of time, the candidates are held until
+// releasePool is called
+func (g *ICEGatherer) gatherPool() error {
+	g.poolLock.Lock()
+	g.pooling = true
+	g.poolLock.Unlock()
+
+	return g.Gather()
+}
+
+// releasePool hands the candidates gathered ahead of time to the
+// OnLocalCandidate handler, the ones gathered afterwards are handed to it
+// as they come
+func (g *ICEGatherer) releasePool() {
+	for {
+		// Candidates gathered while the pool is handed over keep going
+		// to the pool, so they are delivered in order
+		g.poolLock.Lock()
+		pool := g.pool
+		g.pool = nil
+		if len(pool) == 0 {
+			g.pooling = false
+			g.poolLock.Unlock()
+			return
+		}
+		g.poolLock.Unlock()
+
+		for _, c := range pool {
+			g.signalCandidate(c)
+		}
+	}
+}
+
+// reconfigure discards the agent and the candidates gathered ahead of time,
+// the next gathering uses the ICE servers and the gather policy of opts
+func (g *ICEGatherer) reconfigure(opts ICEGatherOptions) error {
+	validatedServers, candidateTypes, err := iceGatherURLsAndTypes(opts, g.agentIsLite)
+	if err != nil {
+		return err
+	}
+	if err = g.Close(); err != nil {
+		return err
+	}
+
+	g.poolLock.Lock()
+	g.pooling, g.pool = false, nil
+	g.poolLock.Unlock()
+
+	g.lock.Lock()
+	g.validatedServers, g.candidateTypes = validatedServers, candidateTypes
+	g.state = ICEGathererStateNew
+	g.lock.Unlock()
+
+	return nil
+}
+
+func (g *ICEGatherer) onLocalCandidate(c *ICECandidate) {
+	g.poolLock.Lock()
+	if g.pooling {
+		g.pool = append(g.pool, c)
+		g.poolLock.Unlock()
+		return
+	}
+	g.poolLock.Unlock()
+
+	g.signalCandidate(c)
+}
+
+// signalCandidate hands c, tagged with the m-section it is gathered for, to
+// the OnLocalCandidate handler
+func (g *ICEGatherer) signalCandidate(c *ICECandidate) {
+	g.lock.RLock()
+	hdlr := g.onLocalCandidateHdlr
+	if c != nil {
+		tagged := *c
+		tagged.sdpMid, tagged.sdpMLineIndex = g.sdpMid, g.sdpMLineIndex
+		c = &tagged
+	}
+	g.lock.RUnlock()
+
+	if hdlr != nil {
+		hdlr(c)
+	}
+}
+
+// setMedia sets the m-section the candidates are gathered for, it is
+// reported with each of them
+func (g *ICEGatherer) setMedia(sdpMid string, sdpMLineIndex uint16) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.sdpMid = sdpMid
+	g.sdpMLineIndex = sdpMLineIndex
+}
+
 // Close prunes all local candidates, and closes the ports.
 func (g *ICEGatherer) Close() error {
 	g.lock.Lock()
@@ -196,6 +314,26 @@ func (g *ICEGatherer) Close() error {
 	return nil
 }
 
+// restart replaces the agent with a new one, which has fresh ICE credentials
+// and needs to gather its candidates again. The previous agent is left
+// running, the ICETransport keeps using it until the new one is connected.
+func (g *ICEGatherer) restart() error {
+	g.lock.Lock()
+	prev, prevState := g.agent, g.state
+	g.agent = nil
+	g.state = ICEGathererStateNew
+	g.lock.Unlock()
+
+	if err := g.createAgent(); err != nil {
+		g.lock.Lock()
+		g.agent, g.state = prev, prevState
+		g.lock.Unlock()
+		return err
+	}
+
+	return nil
+}
+
 // GetLocalParameters returns the ICE parameters of the ICEGatherer.
 func (g *ICEGatherer) GetLocalParameters() (ICEParameters, error) {
 	if err := g.createAgent(); err != nil {
@@ -206,7 +344,7 @@ func (g *ICEGatherer) GetLocalParameters() (ICEParameters, error) {
 	return ICEParameters{
 		UsernameFragment: frag,
 		Password:         pwd,
-		ICELite:          false,
+		ICELite:          g.agentIsLite,
 	}, nil
 }
 
@@ -22,7 +22,7 @@ func TestNewICEGatherer_Success(t *testing.T) {
 		ICEServers: []ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}},
 	}
 
-	gatherer, err := NewICEGatherer(0, 0, nil, nil, nil, nil, nil, nil, nil, logging.NewDefaultLoggerFactory(), false, nil, opts)
+	gatherer, err := NewICEGatherer(0, 0, nil, nil, nil, nil, nil, nil, nil, logging.NewDefaultLoggerFactory(), false, false, nil, opts)
 	if err != nil {
 		t.Error(err)
 	}
@@ -61,6 +61,26 @@ func TestNewICEGatherer_Success(t *testing.T) {
 	}
 }
 
+func TestNewICEGatherer_Lite(t *testing.T) {
+	opts := ICEGatherOptions{
+		ICEServers:      []ICEServer{{URLs: []string{"turn:turn.example.com:3478"}, Username: "user", Credential: "pass"}},
+		ICEGatherPolicy: ICETransportPolicyRelay,
+	}
+
+	gatherer, err := NewICEGatherer(0, 0, nil, nil, nil, nil, nil, nil, nil, logging.NewDefaultLoggerFactory(), false, true, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent can be created, it would refuse URLs or relay candidates
+	if err = gatherer.createAgent(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gatherer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestICEGather_LocalCandidateOrder(t *testing.T) {
 	// Limit runtime in case of deadlocks
 	lim := test.TimeOut(time.Second * 20)
@@ -71,7 +91,7 @@ func TestICEGather_LocalCandidateOrder(t *testing.T) {
 	}
 
 	to := time.Second
-	gatherer, err := NewICEGatherer(10000, 10010, &to, &to, &to, &to, &to, &to, &to, logging.NewDefaultLoggerFactory(), false, []NetworkType{NetworkTypeUDP4}, opts)
+	gatherer, err := NewICEGatherer(10000, 10010, &to, &to, &to, &to, &to, &to, &to, logging.NewDefaultLoggerFactory(), false, false, []NetworkType{NetworkTypeUDP4}, opts)
 	if err != nil {
 		t.Error(err)
 	}
@@ -13,6 +13,10 @@ import (
 	"github.com/pion/logging"
 )
 
+// iceChecklistInterval is how often the candidate pairs are looked at once
+// the remote has signaled the end of its candidates
+const iceChecklistInterval = 200 * time.Millisecond
+
 // ICETransport allows an application access to information about the ICE
 // transport over which packets are sent and received.
 type ICETransport struct {
@@ -26,12 +30,22 @@ type ICETransport struct {
 	onConnectionStateChangeHdlr       func(ICETransportState)
 	onSelectedCandidatePairChangeHdlr func(*ICECandidatePair)
 
-	state ICETransportState
+	state   ICETransportState
+	stopped bool
 
 	gatherer *ICEGatherer
+	agent    *ice.Agent
 	conn     *ice.Conn
 	mux      *mux.Mux
 
+	remoteParameters ICEParameters
+
+	// remoteCandidatesComplete is set once the remote signaled the end of
+	// its candidates, cancelConnect gives up on the connection in progress
+	remoteCandidatesComplete bool
+	connectCtx               context.Context
+	cancelConnect            context.CancelFunc
+
 	loggerFactory logging.LoggerFactory
 
 	log logging.LeveledLogger
@@ -72,6 +86,11 @@ func (t *ICETransport) Start(gatherer *ICEGatherer, params ICEParameters, role *
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	// A stopped transport would recreate the agent of its gatherer
+	if t.stopped {
+		return errors.New("ICETransport has been stopped")
+	}
+
 	if gatherer != nil {
 		t.gatherer = gatherer
 	}
@@ -80,8 +99,111 @@ func (t *ICETransport) Start(gatherer *ICEGatherer, params ICEParameters, role *
 		return err
 	}
 
-	agent := t.gatherer.agent
+	// The gatherer has been closed, by Stop or PeerConnection.Close
+	agent := t.gatherer.getAgent()
+	if agent == nil {
+		return errors.New("gatherer has been closed")
+	}
+	if err := t.handleAgentEvents(agent); err != nil {
+		return err
+	}
+
+	if role == nil {
+		controlled := ICERoleControlled
+		role = &controlled
+	}
+	t.role = *role
+
+	// The lock is dropped while connecting to allow trickle-ICE candidates
+	// to be added so that the agent can complete a connection
+	iceConn, err := t.connect(agent, params, *role)
+	if err != nil {
+		return err
+	}
+
+	t.agent = agent
+	t.conn = iceConn
+	t.remoteParameters = params
+
+	config := mux.Config{
+		Conn:          t.conn,
+		BufferSize:    receiveMTU,
+		LoggerFactory: t.loggerFactory,
+	}
+	t.mux = mux.NewMux(config)
+
+	return nil
+}
+
+// restart connects the agent the gatherer currently holds using the new
+// remote parameters, and moves the mux over to the new connection. DTLS
+// and everything on top of it keep running. The previous agent is closed
+// once the new one is connected.
+func (t *ICETransport) restart(params ICEParameters) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.mux == nil {
+		return errors.New("ICETransport has not been started")
+	}
+
+	agent := t.gatherer.getAgent()
+	if agent == nil {
+		return errors.New("gatherer not started")
+	}
+	if err := t.handleAgentEvents(agent); err != nil {
+		return err
+	}
+	iceConn, err := t.connect(agent, params, t.role)
+	if err != nil {
+		return err
+	}
+
+	t.agent = agent
+	t.conn = iceConn
+	t.remoteParameters = params
+
+	return t.mux.SetConn(iceConn)
+}
+
+// restartNeeded reports whether the remote parameters or the agent of the
+// gatherer differ from the ones the transport is connected with. A transport
+// that isn't connected yet is never restarted.
+func (t *ICETransport) restartNeeded(params ICEParameters) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.agent == nil {
+		return false
+	}
+	return t.remoteParameters.UsernameFragment != params.UsernameFragment ||
+		t.remoteParameters.Password != params.Password ||
+		t.gatherer.getAgent() != t.agent
+}
+
+// restartGatherer gives the gatherer new ICE credentials, unless a restart
+// is pending already
+func (t *ICETransport) restartGatherer() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.agent == nil || t.gatherer.getAgent() != t.agent {
+		return nil
+	}
+
+	// The candidates of the next generation are yet to be signaled
+	t.remoteCandidatesComplete = false
+	return t.gatherer.restart()
+}
+
+func (t *ICETransport) handleAgentEvents(agent *ice.Agent) error {
 	if err := agent.OnConnectionStateChange(func(iceState ice.ConnectionState) {
+		// An agent that has been replaced by an ICE restart no longer
+		// determines the state of the transport
+		if current := t.gatherer.getAgent(); current != nil && current != agent {
+			return
+		}
+
 		state := newICETransportStateFromICE(iceState)
 		t.lock.Lock()
 		t.state = state
@@ -91,60 +213,113 @@ func (t *ICETransport) Start(gatherer *ICEGatherer, params ICEParameters, role *
 	}); err != nil {
 		return err
 	}
-	if err := agent.OnSelectedCandidatePairChange(func(local, remote ice.Candidate) {
+
+	return agent.OnSelectedCandidatePairChange(func(local, remote ice.Candidate) {
 		candidates, err := newICECandidatesFromICE([]ice.Candidate{local, remote})
 		if err != nil {
 			t.log.Warnf("Unable to convert ICE candidates to ICECandidates: %s", err)
 			return
 		}
 		t.onSelectedCandidatePairChange(NewICECandidatePair(&candidates[0], &candidates[1]))
-	}); err != nil {
-		return err
-	}
+	})
+}
 
-	if role == nil {
-		controlled := ICERoleControlled
-		role = &controlled
+// connect connects the agent, the lock is held by the caller and dropped
+// until the agent is connected or has given up
+func (t *ICETransport) connect(agent *ice.Agent, params ICEParameters, role ICERole) (*ice.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.connectCtx, t.cancelConnect = ctx, cancel
+	if t.remoteCandidatesComplete {
+		go t.failOnceChecksFailed(ctx, t.gatherer, agent)
 	}
-	t.role = *role
 
-	// Drop the lock here to allow trickle-ICE candidates to be
-	// added so that the agent can complete a connection
 	t.lock.Unlock()
+	iceConn, err := connectICEAgent(ctx, agent, params, role)
+	t.lock.Lock()
+
+	cancel()
+	t.connectCtx, t.cancelConnect = nil, nil
+	return iceConn, err
+}
+
+// addRemoteCandidatesComplete tells the ICETransport that the remote has
+// signaled all of its candidates
+func (t *ICETransport) addRemoteCandidatesComplete() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.remoteCandidatesComplete {
+		return
+	}
+	t.remoteCandidatesComplete = true
+
+	if t.connectCtx != nil {
+		go t.failOnceChecksFailed(t.connectCtx, t.gatherer, t.gatherer.getAgent())
+	}
+}
+
+// failOnceChecksFailed fails the transport once every candidate pair has
+// failed and the gatherer is done, no candidate that could still succeed
+// is left (RFC 8445 section 8.1.2). hcm007/ice has no end-of-candidates
+// of its own, its agent would keep checking until the transport stops.
+func (t *ICETransport) failOnceChecksFailed(ctx context.Context, gatherer *ICEGatherer, agent *ice.Agent) {
+	if agent == nil {
+		return
+	}
+
+	ticker := time.NewTicker(iceChecklistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if gatherer.State() != ICEGathererStateComplete || !candidatePairsFailed(agent.GetCandidatePairsStats()) {
+			continue
+		}
+
+		t.lock.Lock()
+		if ctx.Err() != nil {
+			t.lock.Unlock()
+			return
+		}
+		t.state = ICETransportStateFailed
+		t.cancelConnect()
+		t.lock.Unlock()
 
-	var iceConn *ice.Conn
-	var err error
-	switch *role {
+		t.onConnectionStateChange(ICETransportStateFailed)
+		return
+	}
+}
+
+// candidatePairsFailed tells if there are candidate pairs and all of them
+// have failed
+func candidatePairsFailed(pairs []ice.CandidatePairStats) bool {
+	for _, pair := range pairs {
+		if pair.State != ice.CandidatePairStateFailed {
+			return false
+		}
+	}
+	return len(pairs) != 0
+}
+
+func connectICEAgent(ctx context.Context, agent *ice.Agent, params ICEParameters, role ICERole) (*ice.Conn, error) {
+	switch role {
 	case ICERoleControlling:
-		iceConn, err = agent.Dial(context.TODO(),
+		return agent.Dial(ctx,
 			params.UsernameFragment,
 			params.Password)
 
 	case ICERoleControlled:
-		iceConn, err = agent.Accept(context.TODO(),
+		return agent.Accept(ctx,
 			params.UsernameFragment,
 			params.Password)
 
 	default:
-		err = errors.New("unknown ICE Role")
-	}
-
-	// Reacquire the lock to set the connection/mux
-	t.lock.Lock()
-	if err != nil {
-		return err
-	}
-
-	t.conn = iceConn
-
-	config := mux.Config{
-		Conn:          t.conn,
-		BufferSize:    receiveMTU,
-		LoggerFactory: t.loggerFactory,
+		return nil, errors.New("unknown ICE Role")
 	}
-	t.mux = mux.NewMux(config)
-
-	return nil
 }
 
 // Stop irreversibly stops the ICETransport.
@@ -152,8 +327,18 @@ func (t *ICETransport) Stop() error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	t.stopped = true
+
 	if t.mux != nil {
-		return t.mux.Close()
+		if err := t.mux.Close(); err != nil {
+			return err
+		}
+
+		// An ICE restart in progress has an agent of its own
+		if t.gatherer != nil && t.gatherer.getAgent() != t.agent {
+			return t.gatherer.Close()
+		}
+		return nil
 	} else if t.gatherer != nil {
 		return t.gatherer.Close()
 	}
@@ -211,12 +396,17 @@ func (t *ICETransport) SetRemoteCandidates(remoteCandidates []ICECandidate) erro
 		return err
 	}
 
+	agent := t.gatherer.getAgent()
+	if agent == nil {
+		return errors.New("gatherer has been closed")
+	}
+
 	for _, c := range remoteCandidates {
 		i, err := c.toICE()
 		if err != nil {
 			return err
 		}
-		err = t.gatherer.agent.AddRemoteCandidate(i)
+		err = agent.AddRemoteCandidate(i)
 		if err != nil {
 			return err
 		}
@@ -234,11 +424,16 @@ func (t *ICETransport) AddRemoteCandidate(remoteCandidate ICECandidate) error {
 		return err
 	}
 
+	agent := t.gatherer.getAgent()
+	if agent == nil {
+		return errors.New("gatherer has been closed")
+	}
+
 	c, err := remoteCandidate.toICE()
 	if err != nil {
 		return err
 	}
-	err = t.gatherer.agent.AddRemoteCandidate(c)
+	err = agent.AddRemoteCandidate(c)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,199 @@
+// +build !js
+
+package webrtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// IdentityProvider generates and validates identity assertions, which bind
+// the DTLS fingerprints of a PeerConnection to the identity of its user.
+// Providers are registered by domain with SettingEngine.AddIdentityProvider,
+// PeerConnection.SetIdentityProvider selects the one asserting the local
+// identity. Remote assertions are validated by the provider registered for
+// the domain they name.
+// https://www.w3.org/TR/webrtc-identity/
+type IdentityProvider interface {
+	// GenerateAssertion binds contents to the identity of the local user
+	GenerateAssertion(contents string) (string, error)
+
+	// ValidateAssertion verifies an assertion generated by the provider,
+	// and returns the identity and the contents it binds
+	ValidateAssertion(assertion string) (IdentityValidationResult, error)
+}
+
+// IdentityValidationResult is the outcome of a successful identity
+// assertion validation
+type IdentityValidationResult struct {
+	// Identity is the identity of the remote user, of the form user@domain
+	Identity string
+
+	// Contents is what the assertion has been generated for
+	Contents string
+}
+
+// identityProviderDefaultProtocol is the protocol announced for providers
+// registered with a SettingEngine
+const identityProviderDefaultProtocol = "default"
+
+// identityAttribute is the JSON carried, base64 encoded, by a=identity
+type identityAttribute struct {
+	IdP struct {
+		Domain   string `json:"domain"`
+		Protocol string `json:"protocol"`
+	} `json:"idp"`
+	Assertion string `json:"assertion"`
+}
+
+// identityContents is what identity assertions bind to an identity, the
+// fingerprints of the certificates used for DTLS
+type identityContents struct {
+	Fingerprint []identityFingerprint `json:"fingerprint"`
+}
+
+type identityFingerprint struct {
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+}
+
+func newIdentityContents(fingerprints []DTLSFingerprint) (string, error) {
+	contents := identityContents{Fingerprint: []identityFingerprint{}}
+	for _, fingerprint := range fingerprints {
+		contents.Fingerprint = append(contents.Fingerprint, identityFingerprint{
+			Algorithm: fingerprint.Algorithm,
+			Digest:    fingerprint.Value,
+		})
+	}
+
+	raw, err := json.Marshal(contents)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// identityContentsMatch tells if contents carries exactly the given
+// fingerprints
+func identityContentsMatch(contents string, fingerprints []DTLSFingerprint) bool {
+	parsed := identityContents{}
+	if err := json.Unmarshal([]byte(contents), &parsed); err != nil {
+		return false
+	}
+	if len(parsed.Fingerprint) != len(fingerprints) {
+		return false
+	}
+
+	for _, fingerprint := range fingerprints {
+		found := false
+		for _, asserted := range parsed.Fingerprint {
+			if strings.EqualFold(asserted.Algorithm, fingerprint.Algorithm) && strings.EqualFold(asserted.Digest, fingerprint.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeIdentityAttribute(domain, protocol, assertion string) (string, error) {
+	attr := identityAttribute{Assertion: assertion}
+	attr.IdP.Domain = domain
+	attr.IdP.Protocol = protocol
+
+	raw, err := json.Marshal(attr)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func decodeIdentityAttribute(value string) (identityAttribute, error) {
+	attr := identityAttribute{}
+
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return attr, err
+	}
+	if err = json.Unmarshal(raw, &attr); err != nil {
+		return attr, err
+	}
+	if attr.IdP.Domain == "" || attr.Assertion == "" {
+		return attr, errors.New("identity attribute is missing the IdP domain or the assertion")
+	}
+	return attr, nil
+}
+
+// localIdentityProvider is an IdentityProvider that runs in-process, its
+// assertions are authenticated with a key shared by all the parties
+type localIdentityProvider struct {
+	identity string
+	key      []byte
+}
+
+type localIdentityAssertion struct {
+	Identity string `json:"identity"`
+	Contents string `json:"contents"`
+}
+
+// NewLocalIdentityProvider creates an IdentityProvider that runs
+// in-process. It asserts identity, and validates the assertions of every
+// local provider sharing key with it. identity may be left empty for a
+// provider that only validates.
+func NewLocalIdentityProvider(identity string, key []byte) IdentityProvider {
+	return &localIdentityProvider{
+		identity: identity,
+		key:      append([]byte{}, key...),
+	}
+}
+
+func (p *localIdentityProvider) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(payload)) // nolint:errcheck
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateAssertion binds contents to the identity of the provider
+func (p *localIdentityProvider) GenerateAssertion(contents string) (string, error) {
+	if p.identity == "" {
+		return "", errors.New("identity provider has no identity to assert")
+	}
+
+	raw, err := json.Marshal(localIdentityAssertion{Identity: p.identity, Contents: contents})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + p.sign(payload), nil
+}
+
+// ValidateAssertion verifies that the assertion has been generated with
+// the key of the provider
+func (p *localIdentityProvider) ValidateAssertion(assertion string) (IdentityValidationResult, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 2 {
+		return IdentityValidationResult{}, errors.New("malformed identity assertion")
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(p.sign(parts[0]))) {
+		return IdentityValidationResult{}, errors.New("identity assertion signature mismatch")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return IdentityValidationResult{}, err
+	}
+
+	parsed := localIdentityAssertion{}
+	if err = json.Unmarshal(raw, &parsed); err != nil {
+		return IdentityValidationResult{}, err
+	}
+	return IdentityValidationResult{Identity: parsed.Identity, Contents: parsed.Contents}, nil
+}
@@ -0,0 +1,48 @@
+// +build !js
+
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalIdentityProvider(t *testing.T) {
+	key := []byte("shared secret")
+	alice := NewLocalIdentityProvider("alice@example.org", key)
+
+	assertion, err := alice.GenerateAssertion("contents")
+	assert.NoError(t, err)
+
+	result, err := NewLocalIdentityProvider("", key).ValidateAssertion(assertion)
+	assert.NoError(t, err)
+	assert.Equal(t, IdentityValidationResult{Identity: "alice@example.org", Contents: "contents"}, result)
+
+	_, err = NewLocalIdentityProvider("", []byte("other secret")).ValidateAssertion(assertion)
+	assert.Error(t, err)
+
+	_, err = NewLocalIdentityProvider("", key).GenerateAssertion("contents")
+	assert.Error(t, err)
+}
+
+func TestIdentityContents(t *testing.T) {
+	fingerprints := []DTLSFingerprint{
+		{Algorithm: "sha-256", Value: "AA:BB"},
+		{Algorithm: "sha-1", Value: "CC:DD"},
+	}
+
+	contents, err := newIdentityContents(fingerprints)
+	assert.NoError(t, err)
+	assert.True(t, identityContentsMatch(contents, fingerprints))
+	assert.True(t, identityContentsMatch(contents, []DTLSFingerprint{fingerprints[1], {Algorithm: "SHA-256", Value: "aa:bb"}}))
+	assert.False(t, identityContentsMatch(contents, fingerprints[:1]))
+	assert.False(t, identityContentsMatch(contents, []DTLSFingerprint{fingerprints[0], {Algorithm: "sha-1", Value: "EE:FF"}}))
+
+	value, err := encodeIdentityAttribute("example.org", identityProviderDefaultProtocol, "assertion")
+	assert.NoError(t, err)
+	attr, err := decodeIdentityAttribute(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.org", attr.IdP.Domain)
+	assert.Equal(t, "assertion", attr.Assertion)
+}
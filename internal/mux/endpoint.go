@@ -38,7 +38,7 @@ func (e *Endpoint) Read(p []byte) (int, error) {
 
 // Write writes len(p) bytes to the underlying conn
 func (e *Endpoint) Write(p []byte) (int, error) {
-	n, err := e.mux.nextConn.Write(p)
+	n, err := e.mux.getConn().Write(p)
 	if err == ice.ErrNoCandidatePairs {
 		return 0, nil
 	} else if err == ice.ErrClosed {
@@ -50,12 +50,12 @@ func (e *Endpoint) Write(p []byte) (int, error) {
 
 // LocalAddr is a stub
 func (e *Endpoint) LocalAddr() net.Addr {
-	return e.mux.nextConn.LocalAddr()
+	return e.mux.getConn().LocalAddr()
 }
 
 // RemoteAddr is a stub
 func (e *Endpoint) RemoteAddr() net.Addr {
-	return e.mux.nextConn.LocalAddr()
+	return e.mux.getConn().LocalAddr()
 }
 
 // SetDeadline is a stub
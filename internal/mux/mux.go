@@ -84,7 +84,7 @@ func (m *Mux) Close() error {
 	}
 	m.lock.Unlock()
 
-	err := m.nextConn.Close()
+	err := m.getConn().Close()
 	if err != nil {
 		return err
 	}
@@ -95,6 +95,23 @@ func (m *Mux) Close() error {
 	return nil
 }
 
+// SetConn replaces the underlying conn, the previous one is closed. Endpoints
+// are kept, so anything layered on top of the Mux is unaffected.
+func (m *Mux) SetConn(conn net.Conn) error {
+	m.lock.Lock()
+	prev := m.nextConn
+	m.nextConn = conn
+	m.lock.Unlock()
+
+	return prev.Close()
+}
+
+func (m *Mux) getConn() net.Conn {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.nextConn
+}
+
 func (m *Mux) readLoop() {
 	defer func() {
 		close(m.closedCh)
@@ -102,8 +119,13 @@ func (m *Mux) readLoop() {
 
 	buf := make([]byte, m.bufferSize)
 	for {
-		n, err := m.nextConn.Read(buf)
+		conn := m.getConn()
+		n, err := conn.Read(buf)
 		if err != nil {
+			// The conn has been replaced by SetConn, continue on the new one
+			if conn != m.getConn() {
+				continue
+			}
 			return
 		}
 
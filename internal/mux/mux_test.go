@@ -102,3 +102,58 @@ func TestNoEndpoints(t *testing.T) {
 	}
 
 }
+
+func TestSetConn(t *testing.T) {
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	ca, cb := net.Pipe()
+	m := NewMux(Config{
+		Conn:          ca,
+		BufferSize:    8192,
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	e := m.NewEndpoint(func([]byte) bool { return true })
+
+	cc, cd := net.Pipe()
+	if err := m.SetConn(cc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Endpoint writes and reads go through the new conn
+	go func() {
+		if _, err := e.Write([]byte{0x01}); err != nil {
+			t.Error(err)
+		}
+	}()
+	buf := make([]byte, 8)
+	if _, err := cd.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := cd.Write([]byte{0x02}); err != nil {
+			t.Error(err)
+		}
+	}()
+	n, err := e.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || buf[0] != 0x02 {
+		t.Fatalf("unexpected packet %v", buf[:n])
+	}
+
+	if err = cb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
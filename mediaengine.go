@@ -45,8 +45,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() {
 // PopulateFromSDP finds all codecs in a session description and adds them to a MediaEngine, using dynamic
 // payload types and parameters from the sdp.
 func (m *MediaEngine) PopulateFromSDP(sd SessionDescription) error {
-	sdpsd := sdp.SessionDescription{}
-	err := sdpsd.Unmarshal([]byte(sd.SDP))
+	sdpsd, err := unmarshalSessionDescription(sd.SDP)
 	if err != nil {
 		return err
 	}
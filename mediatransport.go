@@ -0,0 +1,65 @@
+// +build !js
+
+package webrtc
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hcm007/webrtc/v2/internal/util"
+)
+
+// mediaTransport holds the transports of an m-section that isn't bundled
+// with the others. The m-section returned by bundleTransportMid uses the
+// transports of the PeerConnection itself, which are the only ones that
+// drive its ICEConnectionState. All of them drive its PeerConnectionState.
+type mediaTransport struct {
+	mu sync.Mutex
+
+	iceGatherer   *ICEGatherer
+	iceTransport  *ICETransport
+	dtlsTransport *DTLSTransport
+
+	// The states the PeerConnectionState is derived from, they are guarded
+	// by the lock of the PeerConnection
+	iceConnectionState ICEConnectionState
+	dtlsTransportState DTLSTransportState
+
+	started bool
+}
+
+// start connects the transports to the remote end of the m-section, it
+// blocks until the DTLS handshake is done
+func (t *mediaTransport) start(iceParams ICEParameters, iceRole ICERole, dtlsParams DTLSParameters) error {
+	t.mu.Lock()
+	if t.started {
+		t.mu.Unlock()
+		return nil
+	}
+	t.started = true
+	t.mu.Unlock()
+
+	if err := t.iceTransport.Start(t.iceGatherer, iceParams, &iceRole); err != nil {
+		return fmt.Errorf("failed to start ICETransport: %v", err)
+	}
+	return t.dtlsTransport.Start(dtlsParams)
+}
+
+func (t *mediaTransport) isStarted() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.started
+}
+
+// stop closes all transports, whether they have been started or not. The
+// ICETransport closes the gatherer, or its agent once it has been started.
+func (t *mediaTransport) stop() error {
+	var closeErrs []error
+	if err := t.iceTransport.Stop(); err != nil {
+		closeErrs = append(closeErrs, err)
+	}
+	if err := t.dtlsTransport.Stop(); err != nil {
+		closeErrs = append(closeErrs, err)
+	}
+	return util.FlattenErrs(closeErrs)
+}
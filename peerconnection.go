@@ -9,6 +9,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	mathRand "math/rand"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -30,6 +31,9 @@ type PeerConnection struct {
 	statsID string
 	mu      sync.RWMutex
 
+	// rtpMu serializes startRTP, which runs after every negotiation
+	rtpMu sync.Mutex
+
 	configuration Configuration
 
 	currentLocalDescription  *SessionDescription
@@ -38,9 +42,13 @@ type PeerConnection struct {
 	pendingRemoteDescription *SessionDescription
 	signalingState           SignalingState
 	iceConnectionState       ICEConnectionState
+	dtlsTransportState       DTLSTransportState
 	connectionState          PeerConnectionState
 
-	idpLoginURL *string
+	// idpDomain selects the IdentityProvider asserting our identity,
+	// peerIdentity is the validated identity of the remote peer
+	idpDomain    string
+	peerIdentity string
 
 	isClosed          bool
 	negotiationNeeded bool
@@ -57,15 +65,37 @@ type PeerConnection struct {
 	dataChannelsAccepted  uint32
 
 	onSignalingStateChangeHandler     func(SignalingState)
+	onNegotiationNeededHandler        func()
 	onICEConnectionStateChangeHandler func(ICEConnectionState)
+	onConnectionStateChangeHandler    func(PeerConnectionState)
 	onTrackHandler                    func(*Track, *RTPReceiver)
 	onDataChannelHandler              func(*DataChannel)
+	onErrorHandler                    func(error)
 
 	iceGatherer   *ICEGatherer
 	iceTransport  *ICETransport
 	dtlsTransport *DTLSTransport
 	sctpTransport *SCTPTransport
 
+	// Closed once the goroutine starting the transports returns
+	transportsDone chan struct{}
+
+	// Transceivers created for the remote tracks of a negotiation that
+	// hasn't completed yet, a rollback removes them
+	pendingTransceivers []*RTPTransceiver
+
+	// Transports of the m-sections that aren't bundled, keyed by mid
+	mediaTransports map[string]*mediaTransport
+	// ICEGatherers prefetched for the transports of m-sections that aren't
+	// bundled, along with iceGatherer they make up the candidate pool
+	candidatePool []*ICEGatherer
+
+	onICECandidateHandler func(*ICECandidate)
+
+	// Set once the end of candidates has been signaled with a nil
+	// ICECandidate, until new candidates are gathered
+	iceGatheringSignaled bool
+
 	// A reference to the associated API state used by this connection
 	api *API
 	log logging.LeveledLogger
@@ -101,8 +131,10 @@ func (api *API) NewPeerConnection(configuration Configuration) (*PeerConnection,
 		lastAnswer:         "",
 		signalingState:     SignalingStateStable,
 		iceConnectionState: ICEConnectionStateNew,
+		dtlsTransportState: DTLSTransportStateNew,
 		connectionState:    PeerConnectionStateNew,
 		dataChannels:       make(map[uint16]*DataChannel),
+		mediaTransports:    make(map[string]*mediaTransport),
 
 		api: api,
 		log: api.settingEngine.LoggerFactory.NewLogger("pc"),
@@ -113,29 +145,133 @@ func (api *API) NewPeerConnection(configuration Configuration) (*PeerConnection,
 		return nil, err
 	}
 
-	pc.iceGatherer, err = pc.createICEGatherer()
-	if err != nil {
+	if err = pc.createTransports(); err != nil {
+		return nil, err
+	}
+	if err = pc.startCandidatePool(); err != nil {
 		return nil, err
 	}
 
-	if !pc.iceGatherer.agentIsTrickle {
-		if err = pc.iceGatherer.Gather(); err != nil {
-			return nil, err
+	return pc, nil
+}
+
+// createTransports creates the ICEGatherer, ICETransport and DTLSTransport
+// of the bundled m-sections. The transports replaced by a rollback don't
+// report their state or errors anymore.
+func (pc *PeerConnection) createTransports() error {
+	iceGatherer, err := pc.createICEGatherer()
+	if err != nil {
+		return err
+	}
+
+	if !iceGatherer.agentIsTrickle {
+		if err = iceGatherer.Gather(); err != nil {
+			return err
 		}
 	}
 
 	// Create the ice transport
-	iceTransport := pc.createICETransport()
-	pc.iceTransport = iceTransport
+	iceTransport := pc.createICETransport(iceGatherer)
 
 	// Create the DTLS transport
-	dtlsTransport, err := pc.api.NewDTLSTransport(pc.iceTransport, pc.configuration.Certificates)
+	dtlsTransport, err := pc.api.NewDTLSTransport(iceTransport, pc.configuration.Certificates)
 	if err != nil {
-		return nil, err
+		return err
 	}
+
+	// The handler is run while the DTLSTransport holds its lock, the state
+	// is kept so the ICE handler doesn't need to ask for it
+	dtlsTransport.OnStateChange(func(state DTLSTransportState) {
+		pc.mu.Lock()
+		if pc.dtlsTransport != dtlsTransport {
+			pc.mu.Unlock()
+			return
+		}
+		pc.dtlsTransportState = state
+		pc.mu.Unlock()
+
+		pc.updateConnectionState()
+	})
+	dtlsTransport.OnError(func(err error) {
+		pc.mu.RLock()
+		current := pc.dtlsTransport == dtlsTransport
+		pc.mu.RUnlock()
+		if current {
+			pc.onError(err)
+		}
+	})
+
+	pc.mu.Lock()
+	pc.iceGatherer = iceGatherer
+	pc.iceTransport = iceTransport
 	pc.dtlsTransport = dtlsTransport
+	pc.mu.Unlock()
+	return nil
+}
 
-	return pc, nil
+// resetTransports replaces the transports a rolled back negotiation has
+// started before they connected, the next remote description starts the
+// new ones
+func (pc *PeerConnection) resetTransports() error {
+	pc.mu.Lock()
+	iceGatherer := pc.iceGatherer
+	iceTransport := pc.iceTransport
+	dtlsTransport := pc.dtlsTransport
+	sctpTransport := pc.sctpTransport
+	transportsDone := pc.transportsDone
+	onICECandidateHandler := pc.onICECandidateHandler
+	pc.mu.Unlock()
+
+	if err := pc.createTransports(); err != nil {
+		return err
+	}
+
+	iceGatherer.lock.RLock()
+	onGatheringStateChangeHdlr := iceGatherer.onStateChangeHdlr
+	iceGatherer.lock.RUnlock()
+	pc.iceGatherer.OnStateChange(onGatheringStateChangeHdlr)
+	pc.iceGatherer.OnLocalCandidate(pc.iceCandidateHandler(onICECandidateHandler))
+
+	pc.mu.Lock()
+	pc.sctpTransport = nil
+	pc.transportsDone = nil
+	pc.iceGatheringSignaled = false
+	pc.dtlsTransportState = DTLSTransportStateNew
+	pc.mu.Unlock()
+
+	// Without its ICETransport the goroutine starting the transports gives
+	// up, the others can only be stopped once it returned
+	var closeErrs []error
+	if err := iceTransport.Stop(); err != nil {
+		closeErrs = append(closeErrs, err)
+	}
+	if transportsDone != nil {
+		<-transportsDone
+	}
+	if err := dtlsTransport.Stop(); err != nil {
+		closeErrs = append(closeErrs, err)
+	}
+	if sctpTransport != nil {
+		if err := sctpTransport.Stop(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+
+	for _, t := range pc.GetTransceivers() {
+		if sender := t.getSender(); sender != nil && sender.Transport() == dtlsTransport {
+			sender.setTransport(pc.dtlsTransport)
+		}
+		if receiver := t.getReceiver(); receiver != nil && receiver.Transport() == dtlsTransport {
+			receiver.setTransport(pc.dtlsTransport)
+		}
+	}
+
+	if pc.ICEConnectionState() != ICEConnectionStateNew {
+		pc.iceStateChange(ICEConnectionStateNew)
+	} else {
+		pc.updateConnectionState()
+	}
+	return util.FlattenErrs(closeErrs)
 }
 
 // initConfiguration defines validation of the specified Configuration and
@@ -157,6 +293,10 @@ func (pc *PeerConnection) initConfiguration(configuration Configuration) error {
 			}
 			pc.configuration.Certificates = append(pc.configuration.Certificates, x509Cert)
 		}
+		// The DTLS handshake needs one it can use
+		if _, err := selectCertificate(pc.configuration.Certificates); err != nil {
+			return &rtcerr.InvalidAccessError{Err: err}
+		}
 	} else {
 		sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 		if err != nil {
@@ -229,6 +369,227 @@ func (pc *PeerConnection) onSignalingStateChange(newState SignalingState) (done
 	return
 }
 
+// OnNegotiationNeeded sets an event handler which is invoked when
+// a change has occurred which requires session negotiation
+func (pc *PeerConnection) OnNegotiationNeeded(f func()) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onNegotiationNeededHandler = f
+}
+
+func (pc *PeerConnection) onNegotiationNeeded() (done chan struct{}) {
+	pc.mu.RLock()
+	hdlr := pc.onNegotiationNeededHandler
+	pc.mu.RUnlock()
+
+	pc.log.Debug("negotiation needed")
+	done = make(chan struct{})
+	if hdlr == nil {
+		close(done)
+		return
+	}
+
+	go func() {
+		hdlr()
+		close(done)
+	}()
+
+	return
+}
+
+// updateNegotiationNeeded sets the negotiation-needed flag and fires
+// OnNegotiationNeeded if it wasn't set already. Changes made while a
+// negotiation is in progress are picked up once signaling is stable again.
+// https://www.w3.org/TR/webrtc/#updating-the-negotiation-needed-flag
+func (pc *PeerConnection) updateNegotiationNeeded() {
+	pc.mu.Lock()
+	if pc.isClosed || pc.signalingState != SignalingStateStable {
+		pc.mu.Unlock()
+		return
+	}
+
+	if !pc.checkNegotiationNeeded() {
+		pc.negotiationNeeded = false
+		pc.mu.Unlock()
+		return
+	}
+
+	if pc.negotiationNeeded {
+		pc.mu.Unlock()
+		return
+	}
+	pc.negotiationNeeded = true
+	pc.mu.Unlock()
+
+	pc.onNegotiationNeeded()
+}
+
+// checkNegotiationNeeded compares the transceivers and data channels with
+// the current local description, pc.mu must be held.
+// https://www.w3.org/TR/webrtc/#dfn-check-if-negotiation-is-needed
+func (pc *PeerConnection) checkNegotiationNeeded() bool {
+	localDesc := pc.currentLocalDescription
+	if localDesc == nil || localDesc.parsed == nil {
+		return len(pc.rtpTransceivers) != 0 || len(pc.dataChannels) != 0
+	}
+
+	mediaByMid := map[string]*sdp.MediaDescription{}
+	haveApplication := false
+	for _, m := range localDesc.parsed.MediaDescriptions {
+		mediaByMid[pc.getMidValue(m)] = m
+		if m.MediaName.Media == "application" {
+			haveApplication = true
+		}
+	}
+
+	if len(pc.dataChannels) != 0 && !haveApplication {
+		return true
+	}
+
+	// An answer carries the intersection with what the remote offered
+	remoteByMid := map[string]*sdp.MediaDescription{}
+	if remoteDesc := pc.currentRemoteDescription; localDesc.Type == SDPTypeAnswer && remoteDesc != nil && remoteDesc.parsed != nil {
+		for _, m := range remoteDesc.parsed.MediaDescriptions {
+			remoteByMid[pc.getMidValue(m)] = m
+		}
+	}
+	wantedDirection := func(t *RTPTransceiver) RTPTransceiverDirection {
+		if remote, ok := remoteByMid[t.getMid()]; ok {
+			return t.getDirection().intersect(pc.getPeerDirection(remote).reverse())
+		}
+		return t.getDirection()
+	}
+
+	// With Plan-B several transceivers share a section, only the first one
+	// determines its direction
+	transceiversByMid := map[string]int{}
+	for _, t := range pc.rtpTransceivers {
+		transceiversByMid[t.getMid()]++
+	}
+
+	for _, t := range pc.rtpTransceivers {
+		m, ok := mediaByMid[t.getMid()]
+		switch {
+		case t.isStopped():
+			if ok && m.MediaName.Port.Value != 0 {
+				return true
+			}
+		case !ok:
+			return true
+		case transceiversByMid[t.getMid()] == 1 && pc.getPeerDirection(m) != wantedDirection(t):
+			return true
+		}
+	}
+
+	return false
+}
+
+// OnConnectionStateChange sets an event handler which is called
+// when the PeerConnectionState has changed
+func (pc *PeerConnection) OnConnectionStateChange(f func(PeerConnectionState)) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onConnectionStateChangeHandler = f
+}
+
+func (pc *PeerConnection) onConnectionStateChange(cs PeerConnectionState) (done chan struct{}) {
+	pc.mu.RLock()
+	hdlr := pc.onConnectionStateChangeHandler
+	pc.mu.RUnlock()
+
+	pc.log.Infof("peer connection state changed: %s", cs)
+	done = make(chan struct{})
+	if hdlr == nil {
+		close(done)
+		return
+	}
+
+	go func() {
+		hdlr(cs)
+		close(done)
+	}()
+
+	return
+}
+
+// OnError sets an event handler which is invoked when the DTLS handshake of
+// one of the transports fails, or when the remote certificate is rejected.
+// The PeerConnectionState changes to failed as well when it is the
+// transport of the PeerConnection itself.
+func (pc *PeerConnection) OnError(f func(error)) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onErrorHandler = f
+}
+
+func (pc *PeerConnection) onError(err error) {
+	pc.mu.RLock()
+	hdlr := pc.onErrorHandler
+	pc.mu.RUnlock()
+
+	if hdlr != nil {
+		// The DTLSTransport holds its lock while it reports the error
+		go hdlr(err)
+	}
+}
+
+// updateConnectionState derives the PeerConnectionState from the states of
+// the ICE and DTLS transports, the ones of unbundled m-sections included,
+// and fires OnConnectionStateChange when it
+// changed. https://www.w3.org/TR/webrtc/#rtcpeerconnectionstate-enum
+func (pc *PeerConnection) updateConnectionState() {
+	pc.mu.Lock()
+	iceConnectionStates := []ICEConnectionState{pc.iceConnectionState}
+	dtlsTransportStates := []DTLSTransportState{pc.dtlsTransportState}
+	for _, t := range pc.mediaTransports {
+		iceConnectionStates = append(iceConnectionStates, t.iceConnectionState)
+		dtlsTransportStates = append(dtlsTransportStates, t.dtlsTransportState)
+	}
+
+	anyFailed, anyDisconnected, allNew, allConnected := false, false, true, true
+	for _, state := range iceConnectionStates {
+		switch state {
+		case ICEConnectionStateFailed:
+			anyFailed = true
+		case ICEConnectionStateDisconnected:
+			anyDisconnected = true
+		}
+		allNew = allNew && (state == ICEConnectionStateNew || state == ICEConnectionStateClosed)
+		allConnected = allConnected && (state == ICEConnectionStateConnected ||
+			state == ICEConnectionStateCompleted || state == ICEConnectionStateClosed)
+	}
+	for _, state := range dtlsTransportStates {
+		anyFailed = anyFailed || state == DTLSTransportStateFailed
+		allNew = allNew && (state == DTLSTransportStateNew || state == DTLSTransportStateClosed)
+		allConnected = allConnected && (state == DTLSTransportStateConnected || state == DTLSTransportStateClosed)
+	}
+
+	var connectionState PeerConnectionState
+	switch {
+	case pc.isClosed:
+		connectionState = PeerConnectionStateClosed
+	case anyFailed:
+		connectionState = PeerConnectionStateFailed
+	case anyDisconnected:
+		connectionState = PeerConnectionStateDisconnected
+	case allNew:
+		connectionState = PeerConnectionStateNew
+	case allConnected:
+		connectionState = PeerConnectionStateConnected
+	default:
+		connectionState = PeerConnectionStateConnecting
+	}
+
+	if pc.connectionState == connectionState {
+		pc.mu.Unlock()
+		return
+	}
+	pc.connectionState = connectionState
+	pc.mu.Unlock()
+
+	pc.onConnectionStateChange(connectionState)
+}
+
 // OnDataChannel sets an event handler which is invoked when a data
 // channel message arrives from a remote peer.
 func (pc *PeerConnection) OnDataChannel(f func(*DataChannel)) {
@@ -240,13 +601,67 @@ func (pc *PeerConnection) OnDataChannel(f func(*DataChannel)) {
 // OnICECandidate sets an event handler which is invoked when a new ICE
 // candidate is found.
 func (pc *PeerConnection) OnICECandidate(f func(*ICECandidate)) {
-	pc.iceGatherer.OnLocalCandidate(f)
+	pc.mu.Lock()
+	pc.onICECandidateHandler = f
+	iceGatherer := pc.iceGatherer
+	mediaTransports := make([]*mediaTransport, 0, len(pc.mediaTransports))
+	for _, t := range pc.mediaTransports {
+		mediaTransports = append(mediaTransports, t)
+	}
+	pc.mu.Unlock()
+
+	iceGatherer.OnLocalCandidate(pc.iceCandidateHandler(f))
+	for _, t := range mediaTransports {
+		t.iceGatherer.OnLocalCandidate(pc.iceCandidateHandler(f))
+	}
+}
+
+// iceCandidateHandler forwards the candidates of one of the ICEGatherers,
+// the end of candidates is only signaled once all of them are done
+func (pc *PeerConnection) iceCandidateHandler(f func(*ICECandidate)) func(*ICECandidate) {
+	if f == nil {
+		return nil
+	}
+	return func(c *ICECandidate) {
+		if c != nil {
+			pc.mu.Lock()
+			pc.iceGatheringSignaled = false
+			pc.mu.Unlock()
+
+			f(c)
+			return
+		}
+
+		if pc.iceGatheringComplete() {
+			f(nil)
+		}
+	}
+}
+
+// iceGatheringComplete tells if every ICEGatherer is done and the end of
+// candidates hasn't been signaled yet, it is then marked as signaled
+func (pc *PeerConnection) iceGatheringComplete() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.iceGatheringSignaled || pc.iceGatherer.State() != ICEGathererStateComplete {
+		return false
+	}
+	for _, t := range pc.mediaTransports {
+		if t.iceGatherer.State() != ICEGathererStateComplete {
+			return false
+		}
+	}
+
+	pc.iceGatheringSignaled = true
+	return true
 }
 
 // OnICEGatheringStateChange sets an event handler which is invoked when the
 // ICE candidate gathering state has changed.
 func (pc *PeerConnection) OnICEGatheringStateChange(f func(ICEGathererState)) {
-	pc.iceGatherer.OnStateChange(f)
+	iceGatherer, _, _ := pc.transports()
+	iceGatherer.OnStateChange(f)
 }
 
 // OnTrack sets an event handler which is called when remote track
@@ -360,7 +775,9 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #8)
+	iceConfigurationChanged := false
 	if configuration.ICETransportPolicy != ICETransportPolicy(Unknown) {
+		iceConfigurationChanged = configuration.ICETransportPolicy != pc.configuration.ICETransportPolicy
 		pc.configuration.ICETransportPolicy = configuration.ICETransportPolicy
 	}
 
@@ -372,11 +789,97 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 				return err
 			}
 		}
+		if !reflect.DeepEqual(configuration.ICEServers, pc.configuration.ICEServers) {
+			iceConfigurationChanged = true
+		}
 		pc.configuration.ICEServers = configuration.ICEServers
 	}
+
+	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #11.6)
+	if iceConfigurationChanged {
+		if err := pc.resetCandidatePool(); err != nil {
+			return err
+		}
+	}
+	return pc.startCandidatePool()
+}
+
+// startCandidatePool gathers candidates ahead of time once a candidate pool
+// has been requested, they are signaled when SetLocalDescription is called
+// and used by the offers and answers created until then. The first
+// ICEGatherer of the pool is iceGatherer, the others are handed to the
+// m-sections that get transports of their own. Without trickle the
+// candidates are always gathered ahead of time.
+func (pc *PeerConnection) startCandidatePool() error {
+	size := int(pc.configuration.ICECandidatePoolSize)
+	iceGatherer, _, _ := pc.transports()
+	if !iceGatherer.agentIsTrickle || size == 0 || pc.LocalDescription() != nil {
+		return nil
+	}
+
+	if iceGatherer.State() == ICEGathererStateNew {
+		if err := iceGatherer.gatherPool(); err != nil {
+			return err
+		}
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	for len(pc.candidatePool) > size-1 {
+		last := len(pc.candidatePool) - 1
+		if err := pc.candidatePool[last].Close(); err != nil {
+			return err
+		}
+		pc.candidatePool = pc.candidatePool[:last]
+	}
+	for len(pc.candidatePool) < size-1 {
+		gatherer, err := pc.createICEGatherer()
+		if err != nil {
+			return err
+		}
+		if err = gatherer.gatherPool(); err != nil {
+			return err
+		}
+		pc.candidatePool = append(pc.candidatePool, gatherer)
+	}
 	return nil
 }
 
+// resetCandidatePool discards the candidates gathered with the previous ICE
+// servers, as long as no local description uses them
+func (pc *PeerConnection) resetCandidatePool() error {
+	if pc.LocalDescription() != nil {
+		return nil
+	}
+
+	iceGatherer, _, _ := pc.transports()
+	if err := iceGatherer.reconfigure(ICEGatherOptions{
+		ICEServers:      pc.configuration.ICEServers,
+		ICEGatherPolicy: pc.configuration.ICETransportPolicy,
+	}); err != nil {
+		return err
+	}
+	if !iceGatherer.agentIsTrickle {
+		if err := iceGatherer.Gather(); err != nil {
+			return err
+		}
+	}
+
+	pc.mu.Lock()
+	candidatePool := pc.candidatePool
+	pc.candidatePool = nil
+	pc.mu.Unlock()
+
+	var closeErrs []error
+	for _, gatherer := range candidatePool {
+		if err := gatherer.Close(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+	return util.FlattenErrs(closeErrs)
+}
+
 // GetConfiguration returns a Configuration object representing the current
 // configuration of this PeerConnection object. The returned object is a
 // copy and direct mutation on it will not take affect until SetConfiguration
@@ -394,80 +897,52 @@ func (pc *PeerConnection) getStatsID() string {
 
 // CreateOffer starts the PeerConnection and generates the localDescription
 func (pc *PeerConnection) CreateOffer(options *OfferOptions) (SessionDescription, error) {
-	useIdentity := pc.idpLoginURL != nil
-	switch {
-	case options != nil:
-		return SessionDescription{}, fmt.Errorf("TODO handle options")
-	case useIdentity:
-		return SessionDescription{}, fmt.Errorf("TODO handle identity provider")
-	case pc.isClosed:
+	if pc.isClosed {
 		return SessionDescription{}, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
-	d := sdp.NewJSEPSessionDescription(useIdentity)
-	if err := pc.addFingerprint(d); err != nil {
-		return SessionDescription{}, err
+	// New credentials are used from this offer on, the current ones keep
+	// working until the restart has been negotiated
+	if options != nil && options.ICERestart {
+		_, iceTransport, _ := pc.transports()
+		if err := iceTransport.restartGatherer(); err != nil {
+			return SessionDescription{}, err
+		}
 	}
 
-	iceParams, err := pc.iceGatherer.GetLocalParameters()
-	if err != nil {
+	d := sdp.NewJSEPSessionDescription(false)
+	if err := pc.addFingerprint(d); err != nil {
 		return SessionDescription{}, err
 	}
-
-	candidates, err := pc.iceGatherer.GetLocalCandidates()
-	if err != nil {
+	if err := pc.addIdentity(d); err != nil {
 		return SessionDescription{}, err
 	}
 
-	bundleValue := "BUNDLE"
-	bundleCount := 0
-	appendBundle := func(midValue string) {
-		bundleValue += " " + midValue
-		bundleCount++
-	}
-
-	if pc.configuration.SDPSemantics == SDPSemanticsPlanB {
-		video := make([]*RTPTransceiver, 0)
-		audio := make([]*RTPTransceiver, 0)
-		for _, t := range pc.GetTransceivers() {
-			switch t.kind {
-			case RTPCodecTypeVideo:
-				video = append(video, t)
-			case RTPCodecTypeAudio:
-				audio = append(audio, t)
-			}
-		}
-
-		if len(video) > 0 {
-			if err = pc.addTransceiverSDP(d, "video", iceParams, candidates, sdp.ConnectionRoleActpass, video...); err != nil {
-				return SessionDescription{}, err
-			}
-			appendBundle("video")
-		}
-		if len(audio) > 0 {
-			if err = pc.addTransceiverSDP(d, "audio", iceParams, candidates, sdp.ConnectionRoleActpass, audio...); err != nil {
-				return SessionDescription{}, err
-			}
-			appendBundle("audio")
-		}
+	var err error
+	var mediaSections []mediaSection
+	if pc.currentRemoteDescription == nil {
+		mediaSections = pc.generateUnmatchedMediaSections()
 	} else {
-		for _, t := range pc.GetTransceivers() {
-			midValue := strconv.Itoa(bundleCount)
-			if err = pc.addTransceiverSDP(d, midValue, iceParams, candidates, sdp.ConnectionRoleActpass, t); err != nil {
-				return SessionDescription{}, err
-			}
-			appendBundle(midValue)
+		// pion/webrtc#207 keep the m-lines of the current session in place and
+		// only append what has been added since
+		if mediaSections, err = pc.generateMatchedMediaSections(pc.currentRemoteDescription, true); err != nil {
+			return SessionDescription{}, err
 		}
 	}
 
-	midValue := strconv.Itoa(bundleCount)
-	if pc.configuration.SDPSemantics == SDPSemanticsPlanB {
-		midValue = "data"
+	// BUNDLE is always offered, depending on the BundlePolicy m-sections
+	// have their own transport as well in case the answer rejects it. Once
+	// BUNDLE has been rejected every m-section needs one.
+	var unbundled map[string]bool
+	if pc.currentRemoteDescription == nil {
+		unbundled = unbundledMids(pc.configuration.BundlePolicy, mediaSections)
+	} else if len(pc.getMediaTransports()) != 0 {
+		unbundled = unbundledMids(BundlePolicyMaxCompat, mediaSections)
 	}
-	pc.addDataMediaSection(d, midValue, iceParams, candidates, sdp.ConnectionRoleActpass)
-	appendBundle(midValue)
 
-	d = d.WithValueAttribute(sdp.AttrKeyGroup, bundleValue)
+	if d, err = pc.populateSDP(d, mediaSections, sdp.ConnectionRoleActpass, unbundled, true); err != nil {
+		return SessionDescription{}, err
+	}
 
 	sdpBytes, err := d.Marshal()
 	if err != nil {
@@ -495,27 +970,248 @@ func (pc *PeerConnection) createICEGatherer() (*ICEGatherer, error) {
 	return g, nil
 }
 
-func (pc *PeerConnection) createICETransport() *ICETransport {
-	t := pc.api.NewICETransport(pc.iceGatherer)
+// getMediaTransport returns the transports of an m-section that isn't
+// bundled, they are created the first time the m-section is described
+func (pc *PeerConnection) getMediaTransport(mid string) (*mediaTransport, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if t, ok := pc.mediaTransports[mid]; ok {
+		return t, nil
+	}
+
+	// A prefetched ICEGatherer of the candidate pool already has its
+	// candidates
+	var gatherer *ICEGatherer
+	var err error
+	if len(pc.candidatePool) > 0 {
+		gatherer, pc.candidatePool = pc.candidatePool[0], pc.candidatePool[1:]
+	} else if gatherer, err = pc.createICEGatherer(); err != nil {
+		return nil, err
+	}
+	gatherer.OnLocalCandidate(pc.iceCandidateHandler(pc.onICECandidateHandler))
+
+	if !gatherer.agentIsTrickle {
+		if err = gatherer.Gather(); err != nil {
+			return nil, err
+		}
+	}
+
+	iceTransport := pc.api.NewICETransport(gatherer)
+	dtlsTransport, err := pc.api.NewDTLSTransport(iceTransport, pc.configuration.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	dtlsTransport.OnError(pc.onError)
+
+	t := &mediaTransport{
+		iceGatherer:        gatherer,
+		iceTransport:       iceTransport,
+		dtlsTransport:      dtlsTransport,
+		iceConnectionState: ICEConnectionStateNew,
+		dtlsTransportState: DTLSTransportStateNew,
+	}
+	iceTransport.OnConnectionStateChange(func(state ICETransportState) {
+		pc.mu.Lock()
+		t.iceConnectionState = state.toICEConnectionState()
+		pc.mu.Unlock()
+
+		pc.updateConnectionState()
+	})
+	dtlsTransport.OnStateChange(func(state DTLSTransportState) {
+		pc.mu.Lock()
+		t.dtlsTransportState = state
+		pc.mu.Unlock()
+
+		pc.updateConnectionState()
+	})
+	pc.mediaTransports[mid] = t
+	return t, nil
+}
+
+func (pc *PeerConnection) getMediaTransports() map[string]*mediaTransport {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	mediaTransports := make(map[string]*mediaTransport, len(pc.mediaTransports))
+	for mid, t := range pc.mediaTransports {
+		mediaTransports[mid] = t
+	}
+	return mediaTransports
+}
+
+// dtlsTransportForMid returns the DTLSTransport that carries an m-section
+func (pc *PeerConnection) dtlsTransportForMid(mid string) *DTLSTransport {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	if t, ok := pc.mediaTransports[mid]; ok {
+		return t.dtlsTransport
+	}
+	return pc.dtlsTransport
+}
+
+// iceTransportForMid returns the ICETransport that carries an m-section
+func (pc *PeerConnection) iceTransportForMid(mid string) *ICETransport {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	if t, ok := pc.mediaTransports[mid]; ok {
+		return t.iceTransport
+	}
+	return pc.iceTransport
+}
+
+// iceGathererForMid returns the ICEGatherer that gathers for an m-section
+func (pc *PeerConnection) iceGathererForMid(mid string) *ICEGatherer {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	if t, ok := pc.mediaTransports[mid]; ok {
+		return t.iceGatherer
+	}
+	return pc.iceGatherer
+}
+
+// transports returns the transports of the PeerConnection itself. A rolled
+// back negotiation replaces them, an operation takes them once and keeps
+// using the same ones.
+func (pc *PeerConnection) transports() (*ICEGatherer, *ICETransport, *DTLSTransport) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	return pc.iceGatherer, pc.iceTransport, pc.dtlsTransport
+}
+
+// discardMediaTransports closes the transports that were offered for
+// max-compat but never started, the answer has accepted BUNDLE
+func (pc *PeerConnection) discardMediaTransports() error {
+	var closeErrs []error
+	for mid, t := range pc.getMediaTransports() {
+		if t.isStarted() {
+			continue
+		}
+
+		pc.mu.Lock()
+		delete(pc.mediaTransports, mid)
+		pc.mu.Unlock()
+
+		if err := t.stop(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+
+	// The discarded transports no longer hold the PeerConnectionState back
+	pc.updateConnectionState()
+	return util.FlattenErrs(closeErrs)
+}
+
+// iceRole returns the ICE role of the PeerConnection. The offerer is
+// controlling, unless only one of the agents is lite: the full agent
+// always controls a lite one.
+func (pc *PeerConnection) iceRole(weOffer, remoteIsLite bool) ICERole {
+	localIsLite := pc.api.settingEngine.candidates.ICELite
+	switch {
+	case localIsLite && !remoteIsLite:
+		return ICERoleControlled
+	case remoteIsLite && !localIsLite:
+		return ICERoleControlling
+	case weOffer:
+		return ICERoleControlling
+	default:
+		return ICERoleControlled
+	}
+}
+
+// startMediaTransports connects the transports of the m-sections that
+// aren't bundled, once both the offer and the answer are known
+func (pc *PeerConnection) startMediaTransports(remoteDesc *sdp.SessionDescription, iceRole ICERole, dtlsRole DTLSRole) error {
+	mediaTransports := pc.getMediaTransports()
+	bundleMid := bundleTransportMidFromSDP(remoteDesc)
+	for _, media := range remoteDesc.MediaDescriptions {
+		midValue := pc.getMidValue(media)
+		if media.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		t, ok := mediaTransports[midValue]
+		if !ok && midValue != bundleMid {
+			// With BundlePolicyBalanced only the first m-section of every
+			// media type has been offered with a transport of its own
+			if err := pc.stopTransceiversForMid(midValue); err != nil {
+				return err
+			}
+			continue
+		} else if !ok || t.isStarted() {
+			continue
+		}
+
+		ufrag, pwd, candidates, err := extractMediaICEDetails(media)
+		if err != nil {
+			return err
+		}
+		if ufrag == "" || pwd == "" {
+			ufrag, _ = remoteDesc.Attribute("ice-ufrag")
+			pwd, _ = remoteDesc.Attribute("ice-pwd")
+		}
+
+		var fingerprints []DTLSFingerprint
+		if !pc.api.settingEngine.insecurePlainRTP {
+			if fingerprints, err = extractMediaFingerprints(remoteDesc, media); err != nil {
+				return err
+			}
+		}
+
+		for _, candidate := range candidates {
+			if err = t.iceTransport.AddRemoteCandidate(candidate); err != nil {
+				return err
+			}
+		}
+		if mediaHasAttribute(media, "end-of-candidates", "") {
+			t.iceTransport.addRemoteCandidatesComplete()
+		}
+
+		go func(t *mediaTransport, iceParams ICEParameters, dtlsParams DTLSParameters) {
+			if err := t.start(iceParams, iceRole, dtlsParams); err != nil {
+				pc.mu.RLock()
+				isClosed := pc.isClosed
+				pc.mu.RUnlock()
+
+				// A failed DTLS handshake has been reported by the
+				// DTLSTransport already
+				if !isClosed && t.dtlsTransport.State() != DTLSTransportStateFailed {
+					pc.onError(err)
+				}
+				return
+			}
+
+			pc.startRTP()
+			go pc.drainSRTP(t.dtlsTransport)
+		}(t, ICEParameters{
+			UsernameFragment: ufrag,
+			Password:         pwd,
+			ICELite:          descriptionIsICELite(remoteDesc),
+		}, DTLSParameters{
+			Role:         dtlsRole,
+			Fingerprints: fingerprints,
+		})
+	}
+	return nil
+}
+
+func (pc *PeerConnection) createICETransport(gatherer *ICEGatherer) *ICETransport {
+	t := pc.api.NewICETransport(gatherer)
 
 	t.OnConnectionStateChange(func(state ICETransportState) {
-		var cs ICEConnectionState
-		switch state {
-		case ICETransportStateNew:
-			cs = ICEConnectionStateNew
-		case ICETransportStateChecking:
-			cs = ICEConnectionStateChecking
-		case ICETransportStateConnected:
-			cs = ICEConnectionStateConnected
-		case ICETransportStateCompleted:
-			cs = ICEConnectionStateCompleted
-		case ICETransportStateFailed:
-			cs = ICEConnectionStateFailed
-		case ICETransportStateDisconnected:
-			cs = ICEConnectionStateDisconnected
-		case ICETransportStateClosed:
-			cs = ICEConnectionStateClosed
-		default:
+		pc.mu.RLock()
+		current := pc.iceTransport == t
+		pc.mu.RUnlock()
+		if !current {
+			return
+		}
+
+		cs := state.toICEConnectionState()
+		if cs == ICEConnectionState(Unknown) {
 			pc.log.Warnf("OnConnectionStateChange: unhandled ICE state: %s", state)
 			return
 		}
@@ -534,6 +1230,89 @@ func (pc *PeerConnection) getPeerDirection(media *sdp.MediaDescription) RTPTrans
 	return RTPTransceiverDirection(Unknown)
 }
 
+// setCurrentDirections records the directions negotiated by an answer on
+// the transceivers it covers. A remote answer describes the directions from
+// the remote point of view. A provisional answer only pauses or resumes the
+// senders, the currentDirection is left to the final answer (JSEP 4.2.5).
+func (pc *PeerConnection) setCurrentDirections(answer *sdp.SessionDescription, isLocal, isProvisional bool) {
+	transceivers := pc.GetTransceivers()
+	for _, media := range answer.MediaDescriptions {
+		direction := pc.getPeerDirection(media)
+		switch {
+		case media.MediaName.Port.Value == 0:
+			direction = RTPTransceiverDirectionInactive
+		case direction == RTPTransceiverDirection(Unknown):
+			continue
+		case !isLocal:
+			direction = direction.reverse()
+		}
+
+		midValue := pc.getMidValue(media)
+		for _, t := range transceivers {
+			switch {
+			case t.getMid() != midValue:
+			case isProvisional:
+				t.setProvisionalDirection(direction)
+			default:
+				t.setCurrentDirection(direction)
+			}
+		}
+	}
+}
+
+// stopRejectedTransceivers stops the transceivers whose m-line has been
+// rejected by the remote
+func (pc *PeerConnection) stopRejectedTransceivers(desc *sdp.SessionDescription) error {
+	for _, media := range desc.MediaDescriptions {
+		if media.MediaName.Port.Value != 0 {
+			continue
+		}
+
+		if midValue := pc.getMidValue(media); midValue != "" {
+			if err := pc.stopTransceiversForMid(midValue); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stopTransceiversForMid stops the transceivers of an m-section the
+// remote can't carry media on
+func (pc *PeerConnection) stopTransceiversForMid(midValue string) error {
+	for _, t := range pc.GetTransceivers() {
+		if t.getMid() == midValue {
+			if err := t.Stop(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeStoppedTransceivers drops the stopped transceivers once an answer
+// has rejected their m-line, or if they were never negotiated at all
+func (pc *PeerConnection) removeStoppedTransceivers(answer *sdp.SessionDescription) {
+	rejected := map[string]bool{}
+	for _, media := range answer.MediaDescriptions {
+		if media.MediaName.Port.Value == 0 {
+			rejected[pc.getMidValue(media)] = true
+		}
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	transceivers := []*RTPTransceiver{}
+	for _, t := range pc.rtpTransceivers {
+		if mid := t.getMid(); t.isStopped() && (mid == "" || rejected[mid]) {
+			continue
+		}
+		transceivers = append(transceivers, t)
+	}
+	pc.rtpTransceivers = transceivers
+}
+
 func (pc *PeerConnection) getMidValue(media *sdp.MediaDescription) string {
 	for _, attr := range media.Attributes {
 		if attr.Key == "mid" {
@@ -543,137 +1322,399 @@ func (pc *PeerConnection) getMidValue(media *sdp.MediaDescription) string {
 	return ""
 }
 
-// Given a direction+type pluck a transceiver from the passed list
-// if no entry satisfies the requested type+direction return a inactive Transceiver
-func satisfyTypeAndDirection(remoteKind RTPCodecType, remoteDirection RTPTransceiverDirection, localTransceivers []*RTPTransceiver) (*RTPTransceiver, []*RTPTransceiver) {
-	// Get direction order from most preferred to least
-	getPreferredDirections := func() []RTPTransceiverDirection {
-		switch remoteDirection {
-		case RTPTransceiverDirectionSendrecv:
-			return []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendrecv}
-		case RTPTransceiverDirectionSendonly:
-			return []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendrecv}
-		case RTPTransceiverDirectionRecvonly:
-			return []RTPTransceiverDirection{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionSendrecv}
+// matchTransceiver plucks the first transceiver of the given kind from the
+// passed list, or returns an inactive one if there is none. Directions don't
+// matter (JSEP 5.10), the answer uses the intersection of both sides.
+func matchTransceiver(remoteKind RTPCodecType, localTransceivers []*RTPTransceiver) (*RTPTransceiver, []*RTPTransceiver) {
+	for i := range localTransceivers {
+		t := localTransceivers[i]
+		if t.kind != remoteKind {
+			continue
 		}
-		return []RTPTransceiverDirection{}
+
+		return t, append(localTransceivers[:i], localTransceivers[i+1:]...)
 	}
 
-	for _, possibleDirection := range getPreferredDirections() {
-		for i := range localTransceivers {
-			t := localTransceivers[i]
-			if t.kind != remoteKind || possibleDirection != t.Direction {
+	return &RTPTransceiver{
+		kind:      remoteKind,
+		Direction: RTPTransceiverDirectionInactive,
+	}, localTransceivers
+}
+
+// newRejectedTransceiver returns a placeholder for an m-line that has been
+// rejected and isn't used by any transceiver anymore
+func newRejectedTransceiver(kind RTPCodecType) *RTPTransceiver {
+	return &RTPTransceiver{
+		kind:      kind,
+		Direction: RTPTransceiverDirectionInactive,
+		stopped:   true,
+	}
+}
+
+// localDirection returns the direction a media section carrying the given
+// transceivers is willing to use
+func localDirection(transceivers []*RTPTransceiver) RTPTransceiverDirection {
+	send, recv := false, false
+	for _, t := range transceivers {
+		send = send || t.getDirection().sends()
+		recv = recv || t.getDirection().receives()
+	}
+	return newRTPTransceiverDirectionFromSendRecv(send, recv)
+}
+
+// generateUnmatchedMediaSections returns the media sections of an initial
+// offer, when there is no remote description to keep the m-lines in line with
+func (pc *PeerConnection) generateUnmatchedMediaSections() []mediaSection {
+	mediaSections := []mediaSection{}
+
+	if pc.configuration.SDPSemantics == SDPSemanticsPlanB {
+		video := make([]*RTPTransceiver, 0)
+		audio := make([]*RTPTransceiver, 0)
+		for _, t := range pc.GetTransceivers() {
+			if t.isStopped() {
 				continue
 			}
+			switch t.kind {
+			case RTPCodecTypeVideo:
+				t.setMid("video")
+				video = append(video, t)
+			case RTPCodecTypeAudio:
+				t.setMid("audio")
+				audio = append(audio, t)
+			}
+		}
 
-			return t, append(localTransceivers[:i], localTransceivers[i+1:]...)
+		if len(video) > 0 {
+			mediaSections = append(mediaSections, mediaSection{id: "video", transceivers: video})
 		}
+		if len(audio) > 0 {
+			mediaSections = append(mediaSections, mediaSection{id: "audio", transceivers: audio})
+		}
+		if pc.api.settingEngine.insecurePlainRTP {
+			return mediaSections
+		}
+		return append(mediaSections, mediaSection{id: "data", data: true})
 	}
 
-	return &RTPTransceiver{
-		kind:      remoteKind,
-		Direction: RTPTransceiverDirectionInactive,
-	}, localTransceivers
+	for _, t := range pc.GetTransceivers() {
+		// Never negotiated, so there is no m-line to reject
+		if t.isStopped() {
+			continue
+		}
+		midValue := strconv.Itoa(len(mediaSections))
+		t.setMid(midValue)
+		mediaSections = append(mediaSections, mediaSection{id: midValue, transceivers: []*RTPTransceiver{t}})
+	}
+	if pc.api.settingEngine.insecurePlainRTP {
+		return mediaSections
+	}
+	return append(mediaSections, mediaSection{id: strconv.Itoa(len(mediaSections)), data: true})
 }
 
-func (pc *PeerConnection) addAnswerMediaTransceivers(d *sdp.SessionDescription) (*sdp.SessionDescription, error) {
-	iceParams, err := pc.iceGatherer.GetLocalParameters()
-	if err != nil {
-		return nil, err
+// generateMatchedMediaSections returns media sections that follow the m-lines
+// of desc one for one. Local transceivers that were already negotiated are
+// matched by their mid, others are paired up by kind and direction. When
+// includeUnmatched is set (subsequent offers) local transceivers that have
+// no m-line yet are appended at the end.
+func (pc *PeerConnection) generateMatchedMediaSections(desc *SessionDescription, includeUnmatched bool) ([]mediaSection, error) { //nolint:gocognit
+	detectedPlanB := pc.descriptionIsPlanB(desc)
+	isPlanB := detectedPlanB || (pc.configuration.SDPSemantics == SDPSemanticsPlanB && includeUnmatched)
+
+	usedMids := map[string]bool{}
+	remoteKinds := map[string]RTPCodecType{}
+	for _, media := range desc.parsed.MediaDescriptions {
+		midValue := pc.getMidValue(media)
+		usedMids[midValue] = true
+		remoteKinds[midValue] = NewRTPCodecType(media.MediaName.Media)
 	}
 
-	candidates, err := pc.iceGatherer.GetLocalCandidates()
-	if err != nil {
-		return nil, err
+	// m-lines we rejected ourselves can be recycled by an offer as well
+	localRejected := map[string]bool{}
+	if localDesc := pc.currentLocalDescription; includeUnmatched && localDesc != nil && localDesc.parsed != nil {
+		for _, media := range localDesc.parsed.MediaDescriptions {
+			if media.MediaName.Port.Value == 0 {
+				localRejected[pc.getMidValue(media)] = true
+			}
+		}
+	}
+
+	// Only trust mids once a session has been negotiated, before that they
+	// may come from an offer that was never applied
+	haveNegotiated := pc.currentRemoteDescription != nil
+
+	associated := map[string][]*RTPTransceiver{}
+	localTransceivers := []*RTPTransceiver{}
+	for _, t := range pc.GetTransceivers() {
+		if mid := t.getMid(); haveNegotiated && mid != "" && remoteKinds[mid] == t.kind {
+			associated[mid] = append(associated[mid], t)
+			continue
+		}
+		if t.isStopped() {
+			continue
+		}
+		localTransceivers = append(localTransceivers, t)
+	}
+
+	var t *RTPTransceiver
+	mediaSections := []mediaSection{}
+	alreadyHaveApplicationMediaSection := false
+	for _, media := range desc.parsed.MediaDescriptions {
+		midValue := pc.getMidValue(media)
+		if midValue == "" {
+			return nil, fmt.Errorf("RemoteDescription contained media section without mid value")
+		}
+
+		// Without DTLS there is neither SRTP nor an SCTP association
+		var remoteRejected *sdp.MediaName
+		if pc.api.settingEngine.insecurePlainRTP && !isPlainRTPProtos(media.MediaName.Protos) {
+			remoteRejected = &media.MediaName
+		}
+
+		if media.MediaName.Media == "application" {
+			mediaSections = append(mediaSections, mediaSection{id: midValue, data: true, remoteRejected: remoteRejected})
+			alreadyHaveApplicationMediaSection = true
+			continue
+		}
+
+		kind := NewRTPCodecType(media.MediaName.Media)
+		if kind == 0 {
+			continue
+		}
+
+		if remoteRejected != nil {
+			mediaSections = append(mediaSections, mediaSection{id: midValue, remoteRejected: remoteRejected})
+			continue
+		}
+
+		if media.MediaName.Port.Value == 0 || localRejected[midValue] {
+			// JSEP 5.2.2 a new transceiver recycles a rejected m-line, with
+			// a new mid. Otherwise the m-line stays rejected.
+			if includeUnmatched && !isPlanB && len(localTransceivers) != 0 {
+				t, localTransceivers = localTransceivers[0], localTransceivers[1:]
+				recycledMid := nextMidValue(usedMids)
+				t.setMid(recycledMid)
+				mediaSections = append(mediaSections, mediaSection{id: recycledMid, transceivers: []*RTPTransceiver{t}})
+			} else {
+				mediaSections = append(mediaSections, mediaSection{id: midValue, transceivers: []*RTPTransceiver{newRejectedTransceiver(kind)}})
+			}
+			continue
+		}
+
+		direction := pc.getPeerDirection(media)
+		if direction == RTPTransceiverDirection(Unknown) {
+			continue
+		}
+
+		if !includeUnmatched {
+			switch pc.configuration.SDPSemantics {
+			case SDPSemanticsPlanB:
+				if !detectedPlanB {
+					return nil, &rtcerr.TypeError{Err: ErrIncorrectSDPSemantics}
+				}
+			case SDPSemanticsUnifiedPlan:
+				if detectedPlanB {
+					return nil, &rtcerr.TypeError{Err: ErrIncorrectSDPSemantics}
+				}
+			}
+		}
+
+		mediaTransceivers := associated[midValue]
+		switch {
+		case isPlanB:
+			// A Plan-B section carries every transceiver of that kind
+			for i := 0; i < len(localTransceivers); i++ {
+				if localTransceivers[i].kind == kind {
+					mediaTransceivers = append(mediaTransceivers, localTransceivers[i])
+					localTransceivers = append(localTransceivers[:i], localTransceivers[i+1:]...)
+					i--
+				}
+			}
+		case len(mediaTransceivers) == 0:
+			t, localTransceivers = matchTransceiver(kind, localTransceivers)
+			mediaTransceivers = []*RTPTransceiver{t}
+		}
+
+		if len(mediaTransceivers) == 0 {
+			t, _ = matchTransceiver(kind, nil)
+			mediaTransceivers = []*RTPTransceiver{t}
+		}
+
+		for _, mt := range mediaTransceivers {
+			mt.setMid(midValue)
+		}
+
+		section := mediaSection{id: midValue, transceivers: mediaTransceivers}
+		if pc.api.settingEngine.insecurePlainRTP {
+			section.protos = media.MediaName.Protos
+		}
+		if !includeUnmatched {
+			// An answer may only use what both sides allow
+			section.direction = localDirection(mediaTransceivers).intersect(direction.reverse())
+		}
+		mediaSections = append(mediaSections, section)
+	}
+
+	if !includeUnmatched {
+		if pc.configuration.SDPSemantics == SDPSemanticsUnifiedPlanWithFallback && detectedPlanB {
+			pc.log.Info("Plan-B Offer detected; responding with Plan-B Answer")
+		}
+		return mediaSections, nil
+	}
+
+	if isPlanB {
+		for _, kind := range []RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeAudio} {
+			transceivers := []*RTPTransceiver{}
+			for _, t := range localTransceivers {
+				if t.kind == kind {
+					t.setMid(kind.String())
+					transceivers = append(transceivers, t)
+				}
+			}
+			if len(transceivers) != 0 {
+				mediaSections = append(mediaSections, mediaSection{id: kind.String(), transceivers: transceivers})
+			}
+		}
+	} else {
+		for _, t := range localTransceivers {
+			midValue := nextMidValue(usedMids)
+			t.setMid(midValue)
+			mediaSections = append(mediaSections, mediaSection{id: midValue, transceivers: []*RTPTransceiver{t}})
+		}
+	}
+
+	if !alreadyHaveApplicationMediaSection && !pc.api.settingEngine.insecurePlainRTP {
+		midValue := "data"
+		if !isPlanB {
+			midValue = nextMidValue(usedMids)
+		}
+		mediaSections = append(mediaSections, mediaSection{id: midValue, data: true})
 	}
 
-	bundleValue := "BUNDLE"
-	appendBundle := func(midValue string) {
-		bundleValue += " " + midValue
+	return mediaSections, nil
+}
+
+// populateSDP adds the given media sections to d. The ones in unbundled get
+// transports of their own, the others are bundled on the same transport.
+func (pc *PeerConnection) populateSDP(d *sdp.SessionDescription, mediaSections []mediaSection, dtlsRole sdp.ConnectionRole, unbundled map[string]bool, bundleGroup bool) (*sdp.SessionDescription, error) {
+	if pc.api.settingEngine.candidates.ICELite {
+		d = d.WithPropertyAttribute("ice-lite")
 	}
 
-	var t *RTPTransceiver
-	localTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
-	detectedPlanB := pc.descriptionIsPlanB(pc.RemoteDescription())
+	bundleMid := bundleTransportMid(mediaSections)
+	bundleValue := "BUNDLE"
+	iceGatherer, _, _ := pc.transports()
+	for _, m := range mediaSections {
+		gatherer := iceGatherer
+		if unbundled[m.id] && m.id != bundleMid && !m.rejected() {
+			t, err := pc.getMediaTransport(m.id)
+			if err != nil {
+				return nil, err
+			}
+			gatherer = t.iceGatherer
+		}
 
-	for _, media := range pc.RemoteDescription().parsed.MediaDescriptions {
-		midValue := pc.getMidValue(media)
-		if midValue == "" {
-			return nil, fmt.Errorf("RemoteDescription contained media section without mid value")
+		iceParams, err := gatherer.GetLocalParameters()
+		if err != nil {
+			return nil, err
 		}
 
-		if media.MediaName.Media == "application" {
-			pc.addDataMediaSection(d, midValue, iceParams, candidates, sdp.ConnectionRoleActive)
-			appendBundle(midValue)
+		// Remote m-lines we can't carry have no transport
+		if m.remoteRejected != nil {
+			mediaName := *m.remoteRejected
+			mediaName.Port = sdp.RangedPort{Value: 0}
+			d.WithMedia((&sdp.MediaDescription{MediaName: mediaName}).WithValueAttribute(sdp.AttrKeyMID, m.id))
 			continue
 		}
 
-		kind := NewRTPCodecType(media.MediaName.Media)
-		direction := pc.getPeerDirection(media)
-		if kind == 0 || direction == RTPTransceiverDirection(Unknown) {
+		if m.data {
+			pc.addDataMediaSection(d, m.id, iceParams, dtlsRole)
+		} else if err := pc.addTransceiverSDP(d, m.id, iceParams, dtlsRole, m.protos, m.direction, m.transceivers...); err != nil {
+			return nil, err
+		} else if m.rejected() {
+			// Rejected m-lines aren't part of the BUNDLE group
 			continue
 		}
 
-		t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers)
-		mediaTransceivers := []*RTPTransceiver{t}
-		switch pc.configuration.SDPSemantics {
-		case SDPSemanticsUnifiedPlanWithFallback:
-			// If no match, process as unified-plan
-			if !detectedPlanB {
-				break
-			}
-			// If there was a match, fall through to plan-b
-			fallthrough
-		case SDPSemanticsPlanB:
-			if !detectedPlanB {
-				return nil, &rtcerr.TypeError{Err: ErrIncorrectSDPSemantics}
-			}
-			// If we're responding to a plan-b offer, then we should try to fill up this
-			// media entry with all matching local transceivers
-			for {
-				// keep going until we can't get any more
-				t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers)
-				if t.Direction == RTPTransceiverDirectionInactive {
-					break
-				}
-				mediaTransceivers = append(mediaTransceivers, t)
-			}
-		case SDPSemanticsUnifiedPlan:
-			if detectedPlanB {
-				return nil, &rtcerr.TypeError{Err: ErrIncorrectSDPSemantics}
-			}
-		}
-		if err := pc.addTransceiverSDP(d, midValue, iceParams, candidates, sdp.ConnectionRoleActive, mediaTransceivers...); err != nil {
+		candidates, err := gatherer.GetLocalCandidates()
+		if err != nil {
 			return nil, err
 		}
-		appendBundle(midValue)
+		addCandidatesToMediaDescriptions(candidates, d.MediaDescriptions[len(d.MediaDescriptions)-1], gatherer.State() == ICEGathererStateComplete)
+		bundleValue += " " + m.id
 	}
 
-	if pc.configuration.SDPSemantics == SDPSemanticsUnifiedPlanWithFallback && detectedPlanB {
-		pc.log.Info("Plan-B Offer detected; responding with Plan-B Answer")
+	if !bundleGroup {
+		return d, nil
 	}
-
 	return d.WithValueAttribute(sdp.AttrKeyGroup, bundleValue), nil
 }
 
+func (pc *PeerConnection) addAnswerMediaTransceivers(d *sdp.SessionDescription) (*sdp.SessionDescription, error) {
+	mediaSections, err := pc.generateMatchedMediaSections(pc.RemoteDescription(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without BUNDLE in the offer every m-section gets its own transport
+	var unbundled map[string]bool
+	bundled := descriptionIsBundled(pc.RemoteDescription().parsed)
+	if !bundled {
+		unbundled = unbundledMids(BundlePolicyMaxCompat, mediaSections)
+	}
+	dtlsRole := pc.localDTLSRole(pc.RemoteDescription().parsed, true)
+	return pc.populateSDP(d, mediaSections, dtlsRole.connectionRole(), unbundled, bundled)
+}
+
+// localDTLSRole returns the DTLS role the local end takes for a remote
+// description. A role negotiated before is kept, the DTLS association isn't
+// renegotiated. Otherwise the remote takes it with a=setup:active or passive,
+// an offer with a=setup:actpass leaves it to the SettingEngine. Without
+// a=setup the role is derived from the ICE role.
+func (pc *PeerConnection) localDTLSRole(remoteDesc *sdp.SessionDescription, remoteIsOffer bool) DTLSRole {
+	if role := pc.negotiatedDTLSRole(); role != DTLSRoleAuto {
+		return role
+	}
+	role := dtlsRoleFromRemoteSDP(remoteDesc)
+	if role != DTLSRoleAuto || !remoteIsOffer {
+		return role
+	}
+	if pc.api.settingEngine.answeringDTLSRole == DTLSRoleServer {
+		return DTLSRoleServer
+	}
+	return DTLSRoleClient
+}
+
+// negotiatedDTLSRole returns the local DTLS role the last completed offer and
+// answer settled on, DTLSRoleAuto before that or if it was left to ICE
+func (pc *PeerConnection) negotiatedDTLSRole() DTLSRole {
+	localDesc, remoteDesc := pc.currentLocalDescription, pc.currentRemoteDescription
+	if localDesc == nil || remoteDesc == nil {
+		return DTLSRoleAuto
+	}
+	if remoteDesc.Type == SDPTypeAnswer {
+		return dtlsRoleFromRemoteSDP(remoteDesc.parsed)
+	}
+	return dtlsRoleFromRemoteSDP(localDesc.parsed).reverse()
+}
+
 // CreateAnswer starts the PeerConnection and generates the localDescription
 func (pc *PeerConnection) CreateAnswer(options *AnswerOptions) (SessionDescription, error) {
-	useIdentity := pc.idpLoginURL != nil
 	switch {
 	case options != nil:
 		return SessionDescription{}, fmt.Errorf("TODO handle options")
 	case pc.RemoteDescription() == nil:
 		return SessionDescription{}, &rtcerr.InvalidStateError{Err: ErrNoRemoteDescription}
-	case useIdentity:
-		return SessionDescription{}, fmt.Errorf("TODO handle identity provider")
 	case pc.isClosed:
 		return SessionDescription{}, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
-	d := sdp.NewJSEPSessionDescription(useIdentity)
+	d := sdp.NewJSEPSessionDescription(false)
 	if err := pc.addFingerprint(d); err != nil {
 		return SessionDescription{}, err
 	}
+	if err := pc.addIdentity(d); err != nil {
+		return SessionDescription{}, err
+	}
 
 	d, err := pc.addAnswerMediaTransceivers(d)
 	if err != nil {
@@ -737,8 +1778,10 @@ func (pc *PeerConnection) setDescription(sd *SessionDescription, op stateChangeO
 			nextState, err = checkNextSignalingState(cur, SignalingStateStable, setLocal, sd.Type)
 			if err == nil {
 				pc.pendingLocalDescription = nil
+				pc.pendingRemoteDescription = nil
 			}
 		// have-remote-offer->SetLocal(pranswer)->have-local-pranswer
+		// have-local-pranswer->SetLocal(pranswer)->have-local-pranswer
 		case SDPTypePranswer:
 			if sd.SDP != pc.lastAnswer {
 				return newSDPDoesNotMatchAnswer
@@ -771,9 +1814,11 @@ func (pc *PeerConnection) setDescription(sd *SessionDescription, op stateChangeO
 		case SDPTypeRollback:
 			nextState, err = checkNextSignalingState(cur, SignalingStateStable, setRemote, sd.Type)
 			if err == nil {
+				pc.pendingLocalDescription = nil
 				pc.pendingRemoteDescription = nil
 			}
 		// have-local-offer->SetRemote(pranswer)->have-remote-pranswer
+		// have-remote-pranswer->SetRemote(pranswer)->have-remote-pranswer
 		case SDPTypePranswer:
 			nextState, err = checkNextSignalingState(cur, SignalingStateHaveRemotePranswer, setRemote, sd.Type)
 			if err == nil {
@@ -789,16 +1834,96 @@ func (pc *PeerConnection) setDescription(sd *SessionDescription, op stateChangeO
 	if err == nil {
 		pc.signalingState = nextState
 		pc.onSignalingStateChange(nextState)
+
+		// Changes made during the negotiation need another one
+		if nextState == SignalingStateStable {
+			pc.mu.Lock()
+			pc.negotiationNeeded = false
+			pc.pendingTransceivers = nil
+			pc.mu.Unlock()
+			pc.updateNegotiationNeeded()
+		}
 	}
 	return err
 }
 
+// rollback discards the pending offer and returns to the stable state, mids
+// the offer or its answer have assigned to transceivers are released again
+// and the transceivers and transports created for it are removed. Transports
+// a provisional answer has connected keep running, the next negotiation
+// updates them the way it would after a final answer.
+func (pc *PeerConnection) rollback(op stateChangeOp) error {
+	pc.mu.Lock()
+	pendingTransceivers := pc.pendingTransceivers
+	pc.mu.Unlock()
+
+	if err := pc.setDescription(&SessionDescription{Type: SDPTypeRollback}, op); err != nil {
+		return err
+	}
+
+	for _, t := range pendingTransceivers {
+		if err := t.Stop(); err != nil {
+			return err
+		}
+	}
+	pc.mu.Lock()
+	transceivers := []*RTPTransceiver{}
+	for _, t := range pc.rtpTransceivers {
+		if !containsTransceiver(pendingTransceivers, t) {
+			transceivers = append(transceivers, t)
+		}
+	}
+	pc.rtpTransceivers = transceivers
+	pc.mu.Unlock()
+
+	negotiated := map[string]bool{}
+	if localDesc := pc.currentLocalDescription; localDesc != nil && localDesc.parsed != nil {
+		for _, m := range localDesc.parsed.MediaDescriptions {
+			negotiated[pc.getMidValue(m)] = true
+		}
+	}
+	for _, t := range pc.GetTransceivers() {
+		if !negotiated[t.getMid()] {
+			t.setMid("")
+		}
+
+		// A provisional answer may have paused the sender
+		if direction := t.CurrentDirection(); direction != RTPTransceiverDirection(Unknown) {
+			t.setProvisionalDirection(direction)
+		} else if sender := t.getSender(); sender != nil {
+			sender.setPaused(false)
+		}
+	}
+
+	_, _, dtlsTransport := pc.transports()
+	if pc.currentRemoteDescription == nil && pc.sctpTransport != nil &&
+		dtlsTransport.State() != DTLSTransportStateConnected {
+		if err := pc.resetTransports(); err != nil {
+			return err
+		}
+	}
+	return pc.discardMediaTransports()
+}
+
+func containsTransceiver(transceivers []*RTPTransceiver, t *RTPTransceiver) bool {
+	for _, other := range transceivers {
+		if other == t {
+			return true
+		}
+	}
+	return false
+}
+
 // SetLocalDescription sets the SessionDescription of the local peer
 func (pc *PeerConnection) SetLocalDescription(desc SessionDescription) error {
 	if pc.isClosed {
 		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
+	if desc.Type == SDPTypeRollback {
+		return pc.rollback(stateChangeOpSetLocal)
+	}
+
 	// JSEP 5.4
 	if desc.SDP == "" {
 		switch desc.Type {
@@ -813,26 +1938,89 @@ func (pc *PeerConnection) SetLocalDescription(desc SessionDescription) error {
 		}
 	}
 
-	desc.parsed = &sdp.SessionDescription{}
-	if err := desc.parsed.Unmarshal([]byte(desc.SDP)); err != nil {
+	// A provisional answer has signaled the candidates already
+	haveLocalDescription := pc.currentLocalDescription != nil || pc.pendingLocalDescription != nil
+
+	parsed, err := unmarshalSessionDescription(desc.SDP)
+	if err != nil {
 		return err
 	}
+	desc.parsed = parsed
 	if err := pc.setDescription(&desc, stateChangeOpSetLocal); err != nil {
 		return err
 	}
+	iceGatherer, _, _ := pc.transports()
+
+	// A provisional answer starts early media the way the answer would,
+	// the final answer then updates it
+	if desc.Type == SDPTypeAnswer || desc.Type == SDPTypePranswer {
+		if err := pc.stopRejectedTransceivers(desc.parsed); err != nil {
+			return err
+		}
+		pc.setCurrentDirections(desc.parsed, true, desc.Type == SDPTypePranswer)
+		if desc.Type == SDPTypeAnswer {
+			pc.removeStoppedTransceivers(desc.parsed)
+		}
+
+		if len(pc.getMediaTransports()) != 0 {
+			remoteDesc := pc.RemoteDescription().parsed
+			if err := pc.startMediaTransports(remoteDesc, pc.iceRole(false, descriptionIsICELite(remoteDesc)), pc.localDTLSRole(remoteDesc, true)); err != nil {
+				return err
+			}
+		}
+
+		// An answer to a subsequent offer may add or remove media, the
+		// transports themselves keep running. pion/webrtc#207
+		pc.startRTP()
+	}
 
 	// To support all unittests which are following the future trickle=true
 	// setup while also support the old trickle=false synchronous gathering
 	// process this is necessary to avoid calling Garther() in multiple
 	// pleces; which causes race conditions. (issue-707)
-	if !pc.iceGatherer.agentIsTrickle {
-		if err := pc.iceGatherer.SignalCandidates(); err != nil {
+	if !iceGatherer.agentIsTrickle {
+		// Candidates are only signaled once, renegotiation reuses them
+		if haveLocalDescription {
+			return nil
+		}
+		if err := iceGatherer.SignalCandidates(); err != nil {
 			return err
 		}
 		return nil
 	}
 
-	return pc.iceGatherer.Gather()
+	// Each ICEGatherer reports the first m-section it gathers for
+	tagged := map[*ICEGatherer]bool{}
+	for i, m := range desc.parsed.MediaDescriptions {
+		if m.MediaName.Port.Value == 0 {
+			continue
+		}
+		midValue := pc.getMidValue(m)
+		if gatherer := pc.iceGathererForMid(midValue); !tagged[gatherer] {
+			gatherer.setMedia(midValue, uint16(i))
+			tagged[gatherer] = true
+		}
+	}
+
+	// Candidates prefetched for the pool are signaled from now on
+	iceGatherer.releasePool()
+
+	for _, t := range pc.getMediaTransports() {
+		t.iceGatherer.releasePool()
+		if t.iceGatherer.State() != ICEGathererStateNew {
+			continue
+		}
+		if err := t.iceGatherer.Gather(); err != nil {
+			return err
+		}
+	}
+
+	// Renegotiation reuses the gathered candidates, unless ICE has been
+	// restarted
+	if iceGatherer.State() != ICEGathererStateNew {
+		return nil
+	}
+	return iceGatherer.Gather()
 }
 
 // LocalDescription returns pendingLocalDescription if it is not null and
@@ -848,72 +2036,144 @@ func (pc *PeerConnection) LocalDescription() *SessionDescription {
 
 // SetRemoteDescription sets the SessionDescription of the remote peer
 func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error { //nolint pion/webrtc#614
-	if pc.currentRemoteDescription != nil { // pion/webrtc#207
-		return fmt.Errorf("remoteDescription is already defined, SetRemoteDescription can only be called once")
-	}
 	if pc.isClosed {
 		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
-	desc.parsed = &sdp.SessionDescription{}
-	if err := desc.parsed.Unmarshal([]byte(desc.SDP)); err != nil {
+	if desc.Type == SDPTypeRollback {
+		return pc.rollback(stateChangeOpSetRemote)
+	}
+
+	// The transports have been started by a previous description already,
+	// or by a provisional answer that has been rolled back once connected
+	haveRemoteDescription := pc.sctpTransport != nil
+
+	parsed, err := unmarshalSessionDescription(desc.SDP)
+	if err != nil {
+		return err
+	}
+	desc.parsed = parsed
+
+	isAnswer := desc.Type == SDPTypeAnswer || desc.Type == SDPTypePranswer
+	if err := validateDTLSSetup(desc.parsed, isAnswer, pc.negotiatedDTLSRole()); err != nil {
+		return err
+	}
+
+	peerIdentity, err := pc.validateRemoteIdentity(desc.parsed)
+	if err != nil {
 		return err
 	}
-	if err := pc.setDescription(&desc, stateChangeOpSetRemote); err != nil {
+
+	if err = pc.setDescription(&desc, stateChangeOpSetRemote); err != nil {
 		return err
 	}
+	iceGatherer, iceTransport, dtlsTransport := pc.transports()
+
+	if peerIdentity != "" {
+		pc.mu.Lock()
+		pc.peerIdentity = peerIdentity
+		pc.mu.Unlock()
+	}
 
 	weOffer := true
-	remoteUfrag := ""
-	remotePwd := ""
 	if desc.Type == SDPTypeOffer {
 		weOffer = false
 	}
 
-	fingerprint, haveFingerprint := desc.parsed.Attribute("fingerprint")
-	for _, m := range pc.RemoteDescription().parsed.MediaDescriptions {
-		if !haveFingerprint {
-			fingerprint, haveFingerprint = m.Attribute("fingerprint")
+	// A provisional answer starts early media the way the answer would,
+	// the final answer then updates it
+	if isAnswer {
+		// The remote rejected these m-lines, the transceivers using them
+		// can never be used again. m-lines rejected by a remote offer are
+		// rejected by our answer, which may still be rolled back.
+		if err := pc.stopRejectedTransceivers(desc.parsed); err != nil {
+			return err
+		}
+		pc.setCurrentDirections(desc.parsed, false, desc.Type == SDPTypePranswer)
+		if desc.Type == SDPTypeAnswer {
+			pc.removeStoppedTransceivers(desc.parsed)
 		}
+	}
 
-		for _, a := range m.Attributes {
-			switch {
-			case a.IsICECandidate():
-				sdpCandidate, err := a.ToICECandidate()
-				if err != nil {
-					return err
-				}
+	// Without BUNDLE every m-section has transports of its own. An answer
+	// can only reject BUNDLE if we offered separate transports.
+	unbundled := !descriptionIsBundled(desc.parsed)
+	if isAnswer {
+		unbundled = unbundled && len(pc.getMediaTransports()) != 0
+		if !unbundled {
+			if err := pc.discardMediaTransports(); err != nil {
+				return err
+			}
+		}
+	}
 
-				candidate, err := newICECandidateFromSDP(sdpCandidate)
-				if err != nil {
-					return err
-				}
+	extractDetails := extractICEDetails
+	if unbundled {
+		extractDetails = extractBundleTransportICEDetails
+	}
+	remoteUfrag, remotePwd, candidates, err := extractDetails(desc.parsed)
+	if err != nil {
+		return err
+	}
+	remoteParams := ICEParameters{
+		UsernameFragment: remoteUfrag,
+		Password:         remotePwd,
+		ICELite:          descriptionIsICELite(desc.parsed),
+	}
 
-				if err = pc.iceTransport.AddRemoteCandidate(candidate); err != nil {
-					return err
-				}
-			case strings.HasPrefix(*a.String(), "ice-ufrag"):
-				remoteUfrag = (*a.String())[len("ice-ufrag:"):]
-			case strings.HasPrefix(*a.String(), "ice-pwd"):
-				remotePwd = (*a.String())[len("ice-pwd:"):]
-			}
+	// Changed remote credentials mean the remote restarts ICE, the answer
+	// has to carry new credentials as well
+	if haveRemoteDescription && !weOffer && iceTransport.restartNeeded(remoteParams) {
+		if err = iceTransport.restartGatherer(); err != nil {
+			return err
 		}
 	}
 
-	if !haveFingerprint {
-		return fmt.Errorf("could not find fingerprint")
+	for _, candidate := range candidates {
+		if err = iceTransport.AddRemoteCandidate(candidate); err != nil {
+			return err
+		}
+	}
+	if bundleTransportCandidatesComplete(desc.parsed) {
+		iceTransport.addRemoteCandidatesComplete()
+	}
+
+	if unbundled && isAnswer {
+		if err = pc.startMediaTransports(desc.parsed, pc.iceRole(true, remoteParams.ICELite), pc.localDTLSRole(desc.parsed, false)); err != nil {
+			return err
+		}
+	}
+
+	// pion/webrtc#207 the transports have been started by the first
+	// offer/answer exchange, subsequent ones only change the media or
+	// restart ICE
+	if haveRemoteDescription {
+		if iceTransport.restartNeeded(remoteParams) {
+			go func() {
+				if err := iceTransport.restart(remoteParams); err != nil {
+					pc.log.Warnf("Failed to restart ICE: %s", err)
+				}
+			}()
+		}
+		if weOffer {
+			pc.startRTP()
+		}
+		return nil
 	}
 
-	parts := strings.Split(fingerprint, " ")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid fingerprint")
+	// The remote may use any of the certificates it announces
+	fingerprints := extractFingerprints(desc.parsed)
+	if len(fingerprints) == 0 && !pc.api.settingEngine.insecurePlainRTP {
+		return fmt.Errorf("could not find fingerprint")
 	}
-	fingerprint = parts[1]
-	fingerprintHash := parts[0]
 
 	// Create the SCTP transport
-	sctp := pc.api.NewSCTPTransport(pc.dtlsTransport)
+	sctp := pc.api.NewSCTPTransport(dtlsTransport)
+	transportsDone := make(chan struct{})
+	pc.mu.Lock()
 	pc.sctpTransport = sctp
+	pc.transportsDone = transportsDone
+	pc.mu.Unlock()
 
 	// Wire up the on datachannel handler
 	sctp.OnDataChannel(func(d *DataChannel) {
@@ -937,21 +2197,19 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 	go func() {
 		// Star the networking in a new routine since it will block until
 		// the connection is actually established.
+		defer close(transportsDone)
 
-		// Start the ice transport
-		iceRole := ICERoleControlled
-		if weOffer {
-			iceRole = ICERoleControlling
-		}
-		err := pc.iceTransport.Start(
-			pc.iceGatherer,
-			ICEParameters{
-				UsernameFragment: remoteUfrag,
-				Password:         remotePwd,
-				ICELite:          false,
-			},
-			&iceRole,
-		)
+		// Close may have run since SetRemoteDescription returned
+		pc.mu.RLock()
+		isClosed := pc.isClosed
+		pc.mu.RUnlock()
+		if isClosed {
+			return
+		}
+
+		// Start the ice transport, a rollback may stop it meanwhile
+		iceRole := pc.iceRole(weOffer, remoteParams.ICELite)
+		err := iceTransport.Start(iceGatherer, remoteParams, &iceRole)
 
 		if err != nil {
 			// pion/webrtc#614
@@ -960,9 +2218,9 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 		}
 
 		// Start the dtls transport
-		err = pc.dtlsTransport.Start(DTLSParameters{
-			Role:         dtlsRoleFromRemoteSDP(desc.parsed),
-			Fingerprints: []DTLSFingerprint{{Algorithm: fingerprintHash, Value: fingerprint}},
+		err = dtlsTransport.Start(DTLSParameters{
+			Role:         pc.localDTLSRole(desc.parsed, !weOffer),
+			Fingerprints: fingerprints,
 		})
 		if err != nil {
 			// pion/webrtc#614
@@ -970,28 +2228,17 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 			return
 		}
 
-		pc.openSRTP()
+		pc.startRTP()
 
-		for _, tranceiver := range pc.GetTransceivers() {
-			if tranceiver.Sender != nil {
-				err = tranceiver.Sender.Send(RTPSendParameters{
-					Encodings: RTPEncodingParameters{
-						RTPCodingParameters{
-							SSRC:        tranceiver.Sender.track.SSRC(),
-							PayloadType: tranceiver.Sender.track.PayloadType(),
-						},
-					}})
+		go pc.drainSRTP(dtlsTransport)
 
-				if err != nil {
-					pc.log.Warnf("Failed to start Sender: %s", err)
-				}
-			}
+		// Data channels need DTLS
+		if pc.api.settingEngine.insecurePlainRTP {
+			return
 		}
 
-		go pc.drainSRTP()
-
 		// Start sctp
-		err = pc.sctpTransport.Start(SCTPCapabilities{
+		err = sctp.Start(SCTPCapabilities{
 			MaxMessageSize: 0,
 		})
 		if err != nil {
@@ -1011,7 +2258,7 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 
 		var openedDCCount uint32
 		for _, d := range dataChannels {
-			err := d.open(pc.sctpTransport)
+			err := d.open(sctp)
 			if err != nil {
 				pc.log.Warnf("failed to open data channel: %s", err)
 				continue
@@ -1041,15 +2288,67 @@ func (pc *PeerConnection) descriptionIsPlanB(desc *SessionDescription) bool {
 	return false
 }
 
+// startRTP starts the RTPReceivers and RTPSenders negotiated so far. It is
+// called once the transports are up and again after every subsequent
+// offer/answer exchange, media that is already flowing is left untouched.
+func (pc *PeerConnection) startRTP() {
+	if _, _, dtlsTransport := pc.transports(); dtlsTransport.State() != DTLSTransportStateConnected {
+		// Still connecting, the goroutine started by the first
+		// SetRemoteDescription will pick up the latest descriptions
+		return
+	}
+
+	pc.rtpMu.Lock()
+	defer pc.rtpMu.Unlock()
+
+	pc.openSRTP()
+	pc.startRTPSenders()
+}
+
+// startRTPSenders starts all outbound RTP streams that haven't been started yet
+func (pc *PeerConnection) startRTPSenders() {
+	for _, tranceiver := range pc.GetTransceivers() {
+		sender := tranceiver.getSender()
+		if sender == nil || sender.hasSent() || tranceiver.isStopped() {
+			continue
+		}
+
+		// The track is held until the direction allows sending it
+		if !tranceiver.getDirection().sends() {
+			continue
+		}
+
+		// The track has been removed before it was ever sent
+		track := sender.Track()
+		if track == nil {
+			continue
+		}
+
+		// Without BUNDLE the m-section may have a transport of its own,
+		// which is started on its own as well
+		transport := pc.dtlsTransportForMid(tranceiver.getMid())
+		if transport.State() != DTLSTransportStateConnected {
+			continue
+		}
+		sender.setTransport(transport)
+
+		err := sender.Send(RTPSendParameters{
+			Encodings: RTPEncodingParameters{
+				RTPCodingParameters{
+					SSRC:        sender.getSSRC(),
+					PayloadType: track.PayloadType(),
+				},
+			}})
+		if err != nil {
+			pc.log.Warnf("Failed to start Sender: %s", err)
+		}
+	}
+}
+
 // openSRTP opens knows inbound SRTP streams from the RemoteDescription
 func (pc *PeerConnection) openSRTP() {
-	type incomingTrack struct {
-		kind  RTPCodecType
-		label string
-		id    string
-		ssrc  uint32
-	}
-	incomingTracks := map[uint32]incomingTrack{}
+	_, _, dtlsTransport := pc.transports()
+	incomingTracks := trackDetailsFromSDP(pc.log, pc.RemoteDescription().parsed)
 
 	remoteIsPlanB := false
 	switch pc.configuration.SDPSemantics {
@@ -1059,102 +2358,150 @@ func (pc *PeerConnection) openSRTP() {
 		remoteIsPlanB = pc.descriptionIsPlanB(pc.RemoteDescription())
 	}
 
-	for _, media := range pc.RemoteDescription().parsed.MediaDescriptions {
-		for _, attr := range media.Attributes {
+	startReceiver := func(incoming trackDetails, receiver *RTPReceiver) {
+		err := receiver.Receive(RTPReceiveParameters{
+			Encodings: RTPDecodingParameters{
+				RTPCodingParameters{SSRC: incoming.ssrc},
+			}})
+		if err != nil {
+			pc.log.Warnf("RTPReceiver Receive failed %s", err)
+			return
+		}
 
-			codecType := NewRTPCodecType(media.MediaName.Media)
-			if codecType == 0 {
-				continue
+		go func() {
+			if err := receiver.Track().determinePayloadType(); err != nil {
+				pc.log.Warnf("Could not determine PayloadType for SSRC %d", receiver.Track().SSRC())
+				return
 			}
 
-			if attr.Key == sdp.AttrKeySSRC {
-				split := strings.Split(attr.Value, " ")
-				ssrc, err := strconv.ParseUint(split[0], 10, 32)
-				if err != nil {
-					pc.log.Warnf("Failed to parse SSRC: %v", err)
-					continue
-				}
+			pc.mu.RLock()
+			defer pc.mu.RUnlock()
 
-				trackID := ""
-				trackLabel := ""
-				if len(split) == 3 && strings.HasPrefix(split[1], "msid:") {
-					trackLabel = split[1][len("msid:"):]
-					trackID = split[2]
-				}
+			// Early media arrives before the local description is current
+			localDescription := pc.pendingLocalDescription
+			if localDescription == nil {
+				localDescription = pc.currentLocalDescription
+			}
+			if localDescription == nil {
+				pc.log.Warnf("SetLocalDescription not called, unable to handle incoming media streams")
+				return
+			}
 
-				incomingTracks[uint32(ssrc)] = incomingTrack{codecType, trackLabel, trackID, uint32(ssrc)}
-				if trackID != "" && trackLabel != "" {
-					break // Remote provided Label+ID, we have all the information we need
-				}
+			sdpCodec, err := localDescription.parsed.GetCodecForPayloadType(receiver.Track().PayloadType())
+			if err != nil {
+				pc.log.Warnf("no codec could be found in RemoteDescription for payloadType %d", receiver.Track().PayloadType())
+				return
 			}
-		}
+
+			codec, err := pc.api.mediaEngine.getCodecSDP(sdpCodec)
+			if err != nil {
+				pc.log.Warnf("codec %s in not registered", sdpCodec)
+				return
+			}
+
+			receiver.Track().mu.Lock()
+			receiver.Track().id = incoming.id
+			receiver.Track().label = incoming.label
+			receiver.Track().kind = codec.Type
+			receiver.Track().codec = codec
+			receiver.Track().mu.Unlock()
+
+			if pc.onTrackHandler != nil {
+				pc.onTrack(receiver.Track(), receiver)
+			} else {
+				pc.log.Warnf("OnTrack unset, unable to handle incoming media streams")
+			}
+		}()
 	}
 
-	startReceiver := func(incoming incomingTrack, receiver *RTPReceiver) {
-		err := receiver.Receive(RTPReceiveParameters{
-			Encodings: RTPDecodingParameters{
-				RTPCodingParameters{SSRC: incoming.ssrc},
-			}})
-		if err != nil {
-			pc.log.Warnf("RTPReceiver Receive failed %s", err)
-			return
+	// The mids of the m-sections the remote still carries media on
+	remoteMids := map[string]bool{}
+	for _, media := range pc.RemoteDescription().parsed.MediaDescriptions {
+		if media.MediaName.Port.Value != 0 {
+			remoteMids[pc.getMidValue(media)] = true
 		}
+	}
 
-		if err = receiver.Track().determinePayloadType(); err != nil {
-			pc.log.Warnf("Could not determine PayloadType for SSRC %d", receiver.Track().SSRC())
-			return
+	localTransceivers := []*RTPTransceiver{}
+	for _, t := range pc.GetTransceivers() {
+		switch {
+		case t.isStopped():
+			continue
 		}
 
-		pc.mu.RLock()
-		defer pc.mu.RUnlock()
+		receiver := t.getReceiver()
+		switch {
+		case receiver == nil && t.getDirection().receives():
+			// The direction has been changed to a receiving one since the
+			// transceiver was created
+			var err error
+			if receiver, err = pc.api.NewRTPReceiver(t.kind, dtlsTransport); err != nil {
+				pc.log.Warnf("Failed to create RTPReceiver: %s", err)
+				continue
+			}
+			t.setReceiver(receiver)
+			localTransceivers = append(localTransceivers, t)
+			continue
+		case receiver == nil:
+			continue
+		case !receiver.haveReceived():
+			localTransceivers = append(localTransceivers, t)
+			continue
+		}
 
-		if pc.currentLocalDescription == nil {
-			pc.log.Warnf("SetLocalDescription not called, unable to handle incoming media streams")
-			return
+		// Receivers that are already running keep their track as long as
+		// the remote keeps announcing it
+		ssrc := receiver.Track().SSRC()
+		if _, ok := incomingTracks[ssrc]; ok {
+			delete(incomingTracks, ssrc)
+			continue
 		}
 
-		sdpCodec, err := pc.currentLocalDescription.parsed.GetCodecForPayloadType(receiver.Track().PayloadType())
-		if err != nil {
-			pc.log.Warnf("no codec could be found in RemoteDescription for payloadType %d", receiver.Track().PayloadType())
-			return
+		// A Unified Plan m-section that is still there only stopped
+		// sending, its track resumes once the remote sends again
+		if !remoteIsPlanB && remoteMids[t.getMid()] {
+			continue
 		}
 
-		codec, err := pc.api.mediaEngine.getCodecSDP(sdpCodec)
-		if err != nil {
-			pc.log.Warnf("codec %s in not registered", sdpCodec)
-			return
+		// Plan B shares the m-section with our own tracks, a transceiver
+		// that still sends one only loses the remote track
+		if sender := t.getSender(); remoteIsPlanB && sender != nil && sender.Track() != nil {
+			if err := receiver.Stop(); err != nil {
+				pc.log.Warnf("Failed to stop RTPReceiver for SSRC %d: %s", ssrc, err)
+			}
+			continue
 		}
 
-		receiver.Track().mu.Lock()
-		receiver.Track().id = incoming.id
-		receiver.Track().label = incoming.label
-		receiver.Track().kind = codec.Type
-		receiver.Track().codec = codec
-		receiver.Track().mu.Unlock()
-
-		if pc.onTrackHandler != nil {
-			pc.onTrack(receiver.Track(), receiver)
-		} else {
-			pc.log.Warnf("OnTrack unset, unable to handle incoming media streams")
+		// pion/webrtc#207 the remote removed the track, or its m-section
+		if err := t.Stop(); err != nil {
+			pc.log.Warnf("Failed to stop RTPTransceiver for SSRC %d: %s", ssrc, err)
 		}
 	}
 
-	localTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
 	for ssrc, incoming := range incomingTracks {
+		transport := pc.dtlsTransportForMid(incoming.mid)
+		if transport.State() != DTLSTransportStateConnected {
+			continue
+		}
+
 		for i := range localTransceivers {
 			t := localTransceivers[i]
 			switch {
 			case incomingTracks[ssrc].kind != t.kind:
 				continue
-			case t.Direction != RTPTransceiverDirectionRecvonly && t.Direction != RTPTransceiverDirectionSendrecv:
+			case !t.getDirection().receives():
 				continue
-			case t.Receiver == nil:
+			case !remoteIsPlanB && incoming.mid != "" && incoming.mid != t.getMid():
+				// The track belongs to the transceiver of the media
+				// section that announced it
 				continue
 			}
 
 			delete(incomingTracks, ssrc)
 			localTransceivers = append(localTransceivers[:i], localTransceivers[i+1:]...)
-			go startReceiver(incoming, t.Receiver)
+			receiver := t.getReceiver()
+			receiver.setTransport(transport)
+			startReceiver(incoming, receiver)
 			break
 		}
 	}
@@ -1168,7 +2515,14 @@ func (pc *PeerConnection) openSRTP() {
 				pc.log.Warnf("Could not add transceiver for remote SSRC %d: %s", ssrc, err)
 				continue
 			}
-			go startReceiver(incoming, t.Receiver)
+
+			// Early media of a provisional answer
+			if pc.SignalingState() != SignalingStateStable {
+				pc.mu.Lock()
+				pc.pendingTransceivers = append(pc.pendingTransceivers, t)
+				pc.mu.Unlock()
+			}
+			startReceiver(incoming, t.getReceiver())
 		}
 	}
 }
@@ -1177,11 +2531,15 @@ func (pc *PeerConnection) openSRTP() {
 // These could be sent to the user, but right now we don't provide an API
 // to distribute orphaned RTCP messages. This is needed to make sure we don't block
 // and provides useful debugging messages
-func (pc *PeerConnection) drainSRTP() {
+func (pc *PeerConnection) drainSRTP(dtlsTransport *DTLSTransport) {
 	go func() {
 		for {
-			srtpSession, err := pc.dtlsTransport.getSRTPSession()
-			if err != nil {
+			srtpSession, err := dtlsTransport.getSRTPSession()
+			if err == ErrNoSRTPProtectionProfile {
+				// A data channel only peer may not offer use_srtp, there
+				// is nothing to drain
+				return
+			} else if err != nil {
 				pc.log.Warnf("drainSRTP failed to open SrtpSession: %v", err)
 				return
 			}
@@ -1197,8 +2555,10 @@ func (pc *PeerConnection) drainSRTP() {
 	}()
 
 	for {
-		srtcpSession, err := pc.dtlsTransport.getSRTCPSession()
-		if err != nil {
+		srtcpSession, err := dtlsTransport.getSRTCPSession()
+		if err == ErrNoSRTPProtectionProfile {
+			return
+		} else if err != nil {
 			pc.log.Warnf("drainSRTP failed to open SrtcpSession: %v", err)
 			return
 		}
@@ -1224,13 +2584,29 @@ func (pc *PeerConnection) RemoteDescription() *SessionDescription {
 }
 
 // AddICECandidate accepts an ICE candidate string and adds it
-// to the existing set of candidates
+// to the existing set of candidates. The candidate is added to the
+// ICETransport of the m-section SDPMid, or else SDPMLineIndex, refers to.
+// An empty candidate signals the end of the remote candidates.
 func (pc *PeerConnection) AddICECandidate(candidate ICECandidateInit) error {
-	if pc.RemoteDescription() == nil {
+	remoteDesc := pc.RemoteDescription()
+	if remoteDesc == nil {
 		return &rtcerr.InvalidStateError{Err: ErrNoRemoteDescription}
 	}
 
+	mediaIndex, err := candidateMediaIndex(remoteDesc.parsed, candidate)
+	if err != nil {
+		return err
+	}
+
 	candidateValue := strings.TrimPrefix(candidate.Candidate, "candidate:")
+	if candidateValue == "" {
+		if err = pc.addRemoteCandidatesComplete(remoteDesc, mediaIndex); err != nil {
+			return err
+		}
+		pc.addRemoteAttribute(mediaIndex, sdp.Attribute{Key: "end-of-candidates"})
+		return nil
+	}
+
 	attribute := sdp.NewAttribute("candidate", candidateValue)
 	sdpCandidate, err := attribute.ToICECandidate()
 	if err != nil {
@@ -1242,7 +2618,112 @@ func (pc *PeerConnection) AddICECandidate(candidate ICECandidateInit) error {
 		return err
 	}
 
-	return pc.iceTransport.AddRemoteCandidate(iceCandidate)
+	// Candidates that don't name an m-section are for the transports of the
+	// PeerConnection itself
+	if mediaIndex < 0 {
+		bundleMid := bundleTransportMidFromSDP(remoteDesc.parsed)
+		for i, m := range remoteDesc.parsed.MediaDescriptions {
+			if pc.getMidValue(m) == bundleMid {
+				mediaIndex = i
+				break
+			}
+		}
+	}
+
+	iceTransport, err := pc.iceTransportForCandidate(remoteDesc, mediaIndex)
+	if err != nil {
+		return err
+	}
+	if err = iceTransport.AddRemoteCandidate(iceCandidate); err != nil {
+		return err
+	}
+
+	pc.addRemoteAttribute(mediaIndex, attribute)
+	return nil
+}
+
+// iceTransportForCandidate returns the ICETransport a remote candidate for
+// the m-section at mediaIndex is added to. The transports of an m-section
+// that isn't bundled are created when the remote offer names it first.
+func (pc *PeerConnection) iceTransportForCandidate(remoteDesc *SessionDescription, mediaIndex int) (*ICETransport, error) {
+	_, iceTransport, _ := pc.transports()
+	if mediaIndex < 0 || descriptionIsBundled(remoteDesc.parsed) {
+		return iceTransport, nil
+	}
+
+	m := remoteDesc.parsed.MediaDescriptions[mediaIndex]
+	midValue := pc.getMidValue(m)
+	if m.MediaName.Port.Value == 0 || midValue == bundleTransportMidFromSDP(remoteDesc.parsed) {
+		return iceTransport, nil
+	}
+
+	if remoteDesc.Type == SDPTypeOffer {
+		t, err := pc.getMediaTransport(midValue)
+		if err != nil {
+			return nil, err
+		}
+		return t.iceTransport, nil
+	}
+	return pc.iceTransportForMid(midValue), nil
+}
+
+// addRemoteCandidatesComplete tells the ICETransport of the m-section at
+// mediaIndex, or all of them when mediaIndex is negative, that the remote
+// has signaled all of its candidates
+func (pc *PeerConnection) addRemoteCandidatesComplete(remoteDesc *SessionDescription, mediaIndex int) error {
+	if mediaIndex >= 0 {
+		iceTransport, err := pc.iceTransportForCandidate(remoteDesc, mediaIndex)
+		if err != nil {
+			return err
+		}
+		iceTransport.addRemoteCandidatesComplete()
+		return nil
+	}
+
+	_, iceTransport, _ := pc.transports()
+	iceTransport.addRemoteCandidatesComplete()
+	for _, t := range pc.getMediaTransports() {
+		t.iceTransport.addRemoteCandidatesComplete()
+	}
+	return nil
+}
+
+// addRemoteAttribute adds an attribute signaled by the remote after its
+// description to the m-section at mediaIndex, or to all of them when
+// mediaIndex is negative. The remote description is replaced by an updated
+// copy, the ones already handed out are left untouched: only the changed
+// m-sections are copied, and the line is added to the SDP as it is.
+func (pc *PeerConnection) addRemoteAttribute(mediaIndex int, attribute sdp.Attribute) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	remoteDesc := pc.RemoteDescription()
+	parsed := *remoteDesc.parsed
+	parsed.MediaDescriptions = append([]*sdp.MediaDescription{}, parsed.MediaDescriptions...)
+
+	changed := map[int]bool{}
+	for i, m := range parsed.MediaDescriptions {
+		if (mediaIndex < 0 || i == mediaIndex) && !mediaHasAttribute(m, attribute.Key, attribute.Value) {
+			media := *m
+			media.Attributes = append(append([]sdp.Attribute{}, m.Attributes...), attribute)
+			parsed.MediaDescriptions[i] = &media
+			changed[i] = true
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	updated := &SessionDescription{
+		Type:   remoteDesc.Type,
+		SDP:    addMediaAttributeLines(remoteDesc.SDP, changed, attribute),
+		parsed: &parsed,
+	}
+	if remoteDesc == pc.pendingRemoteDescription {
+		pc.pendingRemoteDescription = updated
+	} else {
+		pc.currentRemoteDescription = updated
+	}
 }
 
 // ICEConnectionState returns the ICE connection state of the
@@ -1261,8 +2742,8 @@ func (pc *PeerConnection) GetSenders() []*RTPSender {
 
 	result := []*RTPSender{}
 	for _, tranceiver := range pc.rtpTransceivers {
-		if tranceiver.Sender != nil {
-			result = append(result, tranceiver.Sender)
+		if sender := tranceiver.getSender(); sender != nil {
+			result = append(result, sender)
 		}
 	}
 	return result
@@ -1275,8 +2756,8 @@ func (pc *PeerConnection) GetReceivers() []*RTPReceiver {
 
 	result := []*RTPReceiver{}
 	for _, tranceiver := range pc.rtpTransceivers {
-		if tranceiver.Receiver != nil {
-			result = append(result, tranceiver.Receiver)
+		if receiver := tranceiver.getReceiver(); receiver != nil {
+			result = append(result, receiver)
 		}
 	}
 	return result
@@ -1295,29 +2776,41 @@ func (pc *PeerConnection) AddTrack(track *Track) (*RTPSender, error) {
 	if pc.isClosed {
 		return nil, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
+	_, _, dtlsTransport := pc.transports()
+
+	// A transceiver that already has an m-line and has never sent anything
+	// carries the track, whether it has been created with a Sender or not
 	var transceiver *RTPTransceiver
 	for _, t := range pc.GetTransceivers() {
-		if !t.stopped &&
-			t.Sender != nil &&
-			!t.Sender.hasSent() &&
-			t.Receiver != nil &&
-			t.Receiver.Track() != nil &&
-			t.Receiver.Track().Kind() == track.Kind() {
+		sender := t.getSender()
+		if !t.isStopped() &&
+			t.getMid() != "" &&
+			t.kind == track.Kind() &&
+			!t.getDirection().sends() &&
+			(sender == nil || (sender.Track() == nil && !sender.hasSent())) {
 			transceiver = t
 			break
 		}
 	}
 	if transceiver != nil {
-		if err := transceiver.setSendingTrack(track); err != nil {
+		sender := transceiver.getSender()
+		if sender == nil {
+			var err error
+			if sender, err = pc.api.NewRTPSender(track, dtlsTransport); err != nil {
+				return nil, err
+			}
+		}
+		if err := transceiver.setSendingTrack(track, sender); err != nil {
 			return nil, err
 		}
+		pc.updateNegotiationNeeded()
 	} else {
-		receiver, err := pc.api.NewRTPReceiver(track.Kind(), pc.dtlsTransport)
+		receiver, err := pc.api.NewRTPReceiver(track.Kind(), dtlsTransport)
 		if err != nil {
 			return nil, err
 		}
 
-		sender, err := pc.api.NewRTPSender(track, pc.dtlsTransport)
+		sender, err := pc.api.NewRTPSender(track, dtlsTransport)
 		if err != nil {
 			return nil, err
 		}
@@ -1329,7 +2822,46 @@ func (pc *PeerConnection) AddTrack(track *Track) (*RTPSender, error) {
 		)
 	}
 
-	return transceiver.Sender, nil
+	return transceiver.getSender(), nil
+}
+
+// RemoveTrack removes a Track from the PeerConnection. The sender stops
+// sending media and the direction of its transceiver no longer includes
+// sending, which is applied by the next negotiation.
+func (pc *PeerConnection) RemoveTrack(sender *RTPSender) error {
+	if pc.isClosed {
+		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
+	}
+
+	var transceiver *RTPTransceiver
+	for _, t := range pc.GetTransceivers() {
+		if sender != nil && t.getSender() == sender {
+			transceiver = t
+			break
+		}
+	}
+	if transceiver == nil {
+		return &rtcerr.InvalidAccessError{Err: ErrSenderNotCreatedByConnection}
+	}
+
+	if sender.Track() == nil {
+		return nil
+	}
+	if err := sender.ReplaceTrack(nil); err != nil {
+		return err
+	}
+
+	transceiver.mu.Lock()
+	switch transceiver.Direction {
+	case RTPTransceiverDirectionSendrecv:
+		transceiver.Direction = RTPTransceiverDirectionRecvonly
+	case RTPTransceiverDirectionSendonly:
+		transceiver.Direction = RTPTransceiverDirectionInactive
+	}
+	transceiver.mu.Unlock()
+
+	pc.updateNegotiationNeeded()
+	return nil
 }
 
 // AddTransceiver Create a new RTCRtpTransceiver and add it to the set of transceivers.
@@ -1338,7 +2870,9 @@ func (pc *PeerConnection) AddTransceiver(trackOrKind RTPCodecType, init ...RtpTr
 	return pc.AddTransceiverFromKind(trackOrKind, init...)
 }
 
-// AddTransceiverFromKind Create a new RTCRtpTransceiver(SendRecv or RecvOnly) and add it to the set of transceivers.
+// AddTransceiverFromKind Create a new RTCRtpTransceiver and add it to the set of transceivers.
+// Sending directions create a Track the application can write to, a
+// Receiver is only created for receiving directions.
 func (pc *PeerConnection) AddTransceiverFromKind(kind RTPCodecType, init ...RtpTransceiverInit) (*RTPTransceiver, error) {
 	direction := RTPTransceiverDirectionSendrecv
 	if len(init) > 1 {
@@ -1348,12 +2882,24 @@ func (pc *PeerConnection) AddTransceiverFromKind(kind RTPCodecType, init ...RtpT
 	}
 
 	switch direction {
-	case RTPTransceiverDirectionSendrecv:
-		receiver, err := pc.api.NewRTPReceiver(kind, pc.dtlsTransport)
-		if err != nil {
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly,
+		RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionInactive:
+	default:
+		return nil, &rtcerr.TypeError{Err: fmt.Errorf("invalid RTPTransceiverDirection %s", direction)}
+	}
+
+	_, _, dtlsTransport := pc.transports()
+
+	var receiver *RTPReceiver
+	if direction.receives() {
+		var err error
+		if receiver, err = pc.api.NewRTPReceiver(kind, dtlsTransport); err != nil {
 			return nil, err
 		}
+	}
 
+	var sender *RTPSender
+	if direction.sends() {
 		codecs := pc.api.mediaEngine.GetCodecsByKind(kind)
 		if len(codecs) == 0 {
 			return nil, fmt.Errorf("no %s codecs found", kind.String())
@@ -1364,36 +2910,22 @@ func (pc *PeerConnection) AddTransceiverFromKind(kind RTPCodecType, init ...RtpT
 			return nil, err
 		}
 
-		sender, err := pc.api.NewRTPSender(track, pc.dtlsTransport)
-		if err != nil {
-			return nil, err
-		}
-
-		return pc.newRTPTransceiver(
-			receiver,
-			sender,
-			RTPTransceiverDirectionSendrecv,
-			kind,
-		), nil
-
-	case RTPTransceiverDirectionRecvonly:
-		receiver, err := pc.api.NewRTPReceiver(kind, pc.dtlsTransport)
-		if err != nil {
+		if sender, err = pc.api.NewRTPSender(track, dtlsTransport); err != nil {
 			return nil, err
 		}
-
-		return pc.newRTPTransceiver(
-			receiver,
-			nil,
-			RTPTransceiverDirectionRecvonly,
-			kind,
-		), nil
-	default:
-		return nil, fmt.Errorf("AddTransceiverFromKind currently only supports recvonly and sendrecv")
 	}
+
+	return pc.newRTPTransceiver(
+		receiver,
+		sender,
+		direction,
+		kind,
+	), nil
 }
 
-// AddTransceiverFromTrack Creates a new send only transceiver and add it to the set of
+// AddTransceiverFromTrack Creates a new transceiver sending the given track and add it to the set of
+// transceivers. With a recvonly or inactive direction the track is kept by the
+// Sender but only sent once the direction has been changed to a sending one.
 func (pc *PeerConnection) AddTransceiverFromTrack(track *Track, init ...RtpTransceiverInit) (*RTPTransceiver, error) {
 	direction := RTPTransceiverDirectionSendrecv
 	if len(init) > 1 {
@@ -1403,39 +2935,33 @@ func (pc *PeerConnection) AddTransceiverFromTrack(track *Track, init ...RtpTrans
 	}
 
 	switch direction {
-	case RTPTransceiverDirectionSendrecv:
-		receiver, err := pc.api.NewRTPReceiver(track.Kind(), pc.dtlsTransport)
-		if err != nil {
-			return nil, err
-		}
-
-		sender, err := pc.api.NewRTPSender(track, pc.dtlsTransport)
-		if err != nil {
-			return nil, err
-		}
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly,
+		RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionInactive:
+	default:
+		return nil, &rtcerr.TypeError{Err: fmt.Errorf("invalid RTPTransceiverDirection %s", direction)}
+	}
 
-		return pc.newRTPTransceiver(
-			receiver,
-			sender,
-			RTPTransceiverDirectionSendrecv,
-			track.Kind(),
-		), nil
+	_, _, dtlsTransport := pc.transports()
 
-	case RTPTransceiverDirectionSendonly:
-		sender, err := pc.api.NewRTPSender(track, pc.dtlsTransport)
-		if err != nil {
+	var receiver *RTPReceiver
+	if direction.receives() {
+		var err error
+		if receiver, err = pc.api.NewRTPReceiver(track.Kind(), dtlsTransport); err != nil {
 			return nil, err
 		}
+	}
 
-		return pc.newRTPTransceiver(
-			nil,
-			sender,
-			RTPTransceiverDirectionSendonly,
-			track.Kind(),
-		), nil
-	default:
-		return nil, fmt.Errorf("AddTransceiverFromTrack currently only supports sendonly and sendrecv")
+	sender, err := pc.api.NewRTPSender(track, dtlsTransport)
+	if err != nil {
+		return nil, err
 	}
+
+	return pc.newRTPTransceiver(
+		receiver,
+		sender,
+		direction,
+		track.Kind(),
+	), nil
 }
 
 // CreateDataChannel creates a new DataChannel object with the given label
@@ -1450,6 +2976,11 @@ func (pc *PeerConnection) CreateDataChannel(label string, options *DataChannelIn
 		return nil, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
+	if pc.api.settingEngine.insecurePlainRTP {
+		pc.mu.Unlock()
+		return nil, &rtcerr.NotSupportedError{Err: ErrDataChannelsUnavailable}
+	}
+
 	// pion/webrtc#748
 	params := &DataChannelParameters{
 		Label:   label,
@@ -1507,6 +3038,8 @@ func (pc *PeerConnection) CreateDataChannel(label string, options *DataChannelIn
 	pc.dataChannelsRequested++
 	pc.mu.Unlock()
 
+	pc.updateNegotiationNeeded()
+
 	// Open if networking already started
 	if sctpReady {
 		err = d.open(pc.sctpTransport)
@@ -1538,9 +3071,106 @@ func (pc *PeerConnection) generateDataChannelID(client bool) (uint16, error) {
 	return 0, &rtcerr.OperationError{Err: ErrMaxDataChannelID}
 }
 
-// SetIdentityProvider is used to configure an identity provider to generate identity assertions
+// SetIdentityProvider is used to configure an identity provider to generate identity assertions.
+// provider is the domain the IdentityProvider has been registered for with
+// SettingEngine.AddIdentityProvider.
 func (pc *PeerConnection) SetIdentityProvider(provider string) error {
-	return fmt.Errorf("TODO SetIdentityProvider")
+	if _, ok := pc.api.settingEngine.identityProviders[provider]; !ok {
+		return &rtcerr.InvalidAccessError{Err: ErrUnknownIdentityProvider}
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.idpDomain = provider
+	return nil
+}
+
+// PeerIdentity returns the identity of the remote peer, it is empty until
+// a remote description with a valid identity assertion has been set
+func (pc *PeerConnection) PeerIdentity() string {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.peerIdentity
+}
+
+// addIdentity asserts our identity over our fingerprints, once an
+// identity provider has been selected
+func (pc *PeerConnection) addIdentity(d *sdp.SessionDescription) error {
+	pc.mu.RLock()
+	domain := pc.idpDomain
+	pc.mu.RUnlock()
+	if domain == "" || pc.api.settingEngine.insecurePlainRTP {
+		return nil
+	}
+
+	fingerprints, err := pc.localFingerprints()
+	if err != nil {
+		return err
+	}
+	contents, err := newIdentityContents(fingerprints)
+	if err != nil {
+		return err
+	}
+
+	assertion, err := pc.api.settingEngine.identityProviders[domain].GenerateAssertion(contents)
+	if err != nil {
+		return &rtcerr.OperationError{Err: err}
+	}
+
+	value, err := encodeIdentityAttribute(domain, identityProviderDefaultProtocol, assertion)
+	if err != nil {
+		return err
+	}
+	d.WithValueAttribute(sdp.AttrKeyIdentity, value)
+	return nil
+}
+
+// validateRemoteIdentity validates the identity assertion of a remote
+// description, and returns the identity it asserts. The assertion has to
+// cover the fingerprints of the description, and the identity has to match
+// PeerIdentity. Once known, the identity of the peer can't change.
+func (pc *PeerConnection) validateRemoteIdentity(desc *sdp.SessionDescription) (string, error) {
+	pc.mu.RLock()
+	expected := pc.peerIdentity
+	if expected == "" {
+		expected = pc.configuration.PeerIdentity
+	}
+	pc.mu.RUnlock()
+
+	value, ok := desc.Attribute(sdp.AttrKeyIdentity)
+	if !ok || value == "" {
+		if expected != "" {
+			return "", &rtcerr.OperationError{Err: ErrPeerIdentityMismatch}
+		}
+		return "", nil
+	}
+
+	attr, err := decodeIdentityAttribute(value)
+	if err != nil {
+		pc.log.Warnf("Failed to decode identity attribute: %v", err)
+		return "", &rtcerr.OperationError{Err: ErrIdentityValidationFailed}
+	}
+
+	provider, ok := pc.api.settingEngine.identityProviders[attr.IdP.Domain]
+	if !ok {
+		return "", &rtcerr.OperationError{Err: ErrUnknownIdentityProvider}
+	}
+
+	result, err := provider.ValidateAssertion(attr.Assertion)
+	if err != nil {
+		pc.log.Warnf("Failed to validate identity assertion: %v", err)
+		return "", &rtcerr.OperationError{Err: ErrIdentityValidationFailed}
+	}
+
+	// The IdP can only assert identities of its own domain
+	if !strings.HasSuffix(result.Identity, "@"+attr.IdP.Domain) || !identityContentsMatch(result.Contents, extractFingerprints(desc)) {
+		return "", &rtcerr.OperationError{Err: ErrIdentityValidationFailed}
+	}
+
+	if expected != "" && result.Identity != expected {
+		return "", &rtcerr.OperationError{Err: ErrPeerIdentityMismatch}
+	}
+	return result.Identity, nil
 }
 
 // WriteRTCP sends a user provided RTCP packet to the connected peer
@@ -1551,7 +3181,8 @@ func (pc *PeerConnection) WriteRTCP(pkts []rtcp.Packet) error {
 		return err
 	}
 
-	srtcpSession, err := pc.dtlsTransport.getSRTCPSession()
+	_, _, dtlsTransport := pc.transports()
+	srtcpSession, err := dtlsTransport.getSRTCPSession()
 	if err != nil {
 		return nil
 	}
@@ -1582,25 +3213,44 @@ func (pc *PeerConnection) Close() error {
 	var closeErrs []error
 
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-close (step #3)
+	pc.mu.Lock()
 	pc.isClosed = true
+	iceTransport, dtlsTransport := pc.iceTransport, pc.dtlsTransport
+	pc.mu.Unlock()
 
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-close (step #4)
 	pc.signalingState = SignalingStateClosed
 
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-close (step #11)
-	if pc.iceTransport != nil {
-		if err := pc.iceTransport.Stop(); err != nil {
+	if iceTransport != nil {
+		if err := iceTransport.Stop(); err != nil {
 			closeErrs = append(closeErrs, err)
 		}
 	}
 
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-close (step #12)
-	pc.connectionState = PeerConnectionStateClosed
+	pc.updateConnectionState()
 
-	if err := pc.dtlsTransport.Stop(); err != nil {
+	if err := dtlsTransport.Stop(); err != nil {
 		closeErrs = append(closeErrs, err)
 	}
 
+	for _, t := range pc.getMediaTransports() {
+		if err := t.stop(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+
+	pc.mu.Lock()
+	candidatePool := pc.candidatePool
+	pc.candidatePool = nil
+	pc.mu.Unlock()
+	for _, gatherer := range candidatePool {
+		if err := gatherer.Close(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+
 	if pc.sctpTransport != nil {
 		if err := pc.sctpTransport.Stop(); err != nil {
 			closeErrs = append(closeErrs, err)
@@ -1621,28 +3271,71 @@ func (pc *PeerConnection) iceStateChange(newState ICEConnectionState) {
 	pc.mu.Unlock()
 
 	pc.onICEConnectionStateChange(newState)
+	pc.updateConnectionState()
 }
 
 func (pc *PeerConnection) addFingerprint(d *sdp.SessionDescription) error {
-	// pion/webrtc#753
-	fingerprints, err := pc.configuration.Certificates[0].GetFingerprints()
+	// Plain RTP has no DTLS certificate to announce
+	if pc.api.settingEngine.insecurePlainRTP {
+		return nil
+	}
+
+	fingerprints, err := pc.localFingerprints()
 	if err != nil {
 		return err
 	}
 	for _, fingerprint := range fingerprints {
-		d.WithFingerprint(fingerprint.Algorithm, strings.ToUpper(fingerprint.Value))
+		d.WithFingerprint(fingerprint.Algorithm, fingerprint.Value)
 	}
 	return nil
 }
 
-func (pc *PeerConnection) addTransceiverSDP(d *sdp.SessionDescription, midValue string, iceParams ICEParameters, candidates []ICECandidate, dtlsRole sdp.ConnectionRole, transceivers ...*RTPTransceiver) error {
+// localFingerprints returns the fingerprints we announce in our
+// descriptions, those of every certificate DTLS may use
+func (pc *PeerConnection) localFingerprints() ([]DTLSFingerprint, error) {
+	fingerprints := []DTLSFingerprint{}
+	for _, certificate := range pc.configuration.Certificates {
+		certificateFingerprints, err := certificate.GetFingerprints()
+		if err != nil {
+			return nil, err
+		}
+		for _, fingerprint := range certificateFingerprints {
+			fingerprint.Value = strings.ToUpper(fingerprint.Value)
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	return fingerprints, nil
+}
+
+func (pc *PeerConnection) addTransceiverSDP(d *sdp.SessionDescription, midValue string, iceParams ICEParameters, dtlsRole sdp.ConnectionRole, protos []string, direction RTPTransceiverDirection, transceivers ...*RTPTransceiver) error {
 	if len(transceivers) < 1 {
 		return fmt.Errorf("addTransceiverSDP() called with 0 transceivers")
 	}
 	// Use the first transceiver to generate the section attributes
 	t := transceivers[0]
-	media := sdp.NewJSEPMediaDescription(t.kind.String(), []string{}).
-		WithValueAttribute(sdp.AttrKeyConnectionSetup, dtlsRole.String()).
+
+	if len(protos) == 0 {
+		protos = pc.mediaProtos()
+	}
+
+	if (mediaSection{transceivers: transceivers}).rejected() {
+		d.WithMedia((&sdp.MediaDescription{
+			MediaName: sdp.MediaName{
+				Media:   t.kind.String(),
+				Port:    sdp.RangedPort{Value: 0},
+				Protos:  protos,
+				Formats: []string{"0"},
+			},
+		}).WithValueAttribute(sdp.AttrKeyMID, midValue))
+		return nil
+	}
+	media := sdp.NewJSEPMediaDescription(t.kind.String(), []string{})
+	if pc.api.settingEngine.insecurePlainRTP {
+		media.MediaName.Protos = protos
+	} else {
+		media = media.WithValueAttribute(sdp.AttrKeyConnectionSetup, dtlsRole.String())
+	}
+	media = media.
 		WithValueAttribute(sdp.AttrKeyMID, midValue).
 		WithICECredentials(iceParams.UsernameFragment, iceParams.Password).
 		WithPropertyAttribute(sdp.AttrKeyRTCPMux).
@@ -1652,6 +3345,10 @@ func (pc *PeerConnection) addTransceiverSDP(d *sdp.SessionDescription, midValue
 	for _, codec := range codecs {
 		media.WithCodec(codec.PayloadType, codec.Name, codec.ClockRate, codec.Channels, codec.SDPFmtpLine)
 
+		// RTCP feedback needs the AVPF profile (RFC 4585)
+		if protos[len(protos)-1] == "AVP" {
+			continue
+		}
 		for _, feedback := range codec.RTPCodecCapability.RTCPFeedback {
 			media.WithValueAttribute("rtcp-fb", fmt.Sprintf("%d %s %s", codec.PayloadType, feedback.Type, feedback.Parameter))
 		}
@@ -1662,17 +3359,25 @@ func (pc *PeerConnection) addTransceiverSDP(d *sdp.SessionDescription, midValue
 			MediaName: sdp.MediaName{
 				Media:   t.kind.String(),
 				Port:    sdp.RangedPort{Value: 0},
-				Protos:  []string{"UDP", "TLS", "RTP", "SAVPF"},
+				Protos:  protos,
 				Formats: []string{"0"},
 			},
 		})
 		return nil
 	}
 
+	if direction == RTPTransceiverDirection(Unknown) {
+		direction = localDirection(transceivers)
+	}
+
 	for _, mt := range transceivers {
-		if mt.Sender != nil && mt.Sender.track != nil {
-			track := mt.Sender.track
-			media = media.WithMediaSource(track.SSRC(), track.Label() /* cname */, track.Label() /* streamLabel */, track.ID())
+		// Tracks are only announced while they are going to be sent
+		sender := mt.getSender()
+		if sender == nil || mt.isStopped() || !mt.getDirection().sends() || !direction.sends() {
+			continue
+		}
+		if track := sender.Track(); track != nil {
+			media = media.WithMediaSource(sender.announceSSRC(), track.Label() /* cname */, track.Label() /* streamLabel */, track.ID())
 			if pc.configuration.SDPSemantics == SDPSemanticsUnifiedPlan {
 				media = media.WithPropertyAttribute("msid:" + track.Label() + " " + track.ID())
 				break
@@ -1680,15 +3385,24 @@ func (pc *PeerConnection) addTransceiverSDP(d *sdp.SessionDescription, midValue
 		}
 	}
 
-	media = media.WithPropertyAttribute(t.Direction.String())
+	media = media.WithPropertyAttribute(direction.String())
 
-	addCandidatesToMediaDescriptions(candidates, media)
 	d.WithMedia(media)
 
 	return nil
 }
 
-func (pc *PeerConnection) addDataMediaSection(d *sdp.SessionDescription, midValue string, iceParams ICEParameters, candidates []ICECandidate, dtlsRole sdp.ConnectionRole) {
+// mediaProtos returns the transport protocol our audio and video m-lines
+// are offered with, RTP/AVPF when SRTP has been disabled by the
+// SettingEngine
+func (pc *PeerConnection) mediaProtos() []string {
+	if pc.api.settingEngine.insecurePlainRTP {
+		return []string{"RTP", "AVPF"}
+	}
+	return []string{"UDP", "TLS", "RTP", "SAVPF"}
+}
+
+func (pc *PeerConnection) addDataMediaSection(d *sdp.SessionDescription, midValue string, iceParams ICEParameters, dtlsRole sdp.ConnectionRole) {
 	media := (&sdp.MediaDescription{
 		MediaName: sdp.MediaName{
 			Media:   "application",
@@ -1710,7 +3424,6 @@ func (pc *PeerConnection) addDataMediaSection(d *sdp.SessionDescription, midValu
 		WithPropertyAttribute("sctpmap:5000 webrtc-datachannel 1024").
 		WithICECredentials(iceParams.UsernameFragment, iceParams.Password)
 
-	addCandidatesToMediaDescriptions(candidates, media)
 	d.WithMedia(media)
 }
 
@@ -1734,32 +3447,42 @@ func (pc *PeerConnection) newRTPTransceiver(
 ) *RTPTransceiver {
 
 	t := &RTPTransceiver{
-		Receiver:  receiver,
-		Sender:    sender,
-		Direction: direction,
-		kind:      kind,
+		Receiver:          receiver,
+		Sender:            sender,
+		Direction:         direction,
+		kind:              kind,
+		negotiationNeeded: pc.updateNegotiationNeeded,
 	}
 	pc.mu.Lock()
-	defer pc.mu.Unlock()
 	pc.rtpTransceivers = append(pc.rtpTransceivers, t)
+	pc.mu.Unlock()
+
+	pc.updateNegotiationNeeded()
 	return t
 }
 
 func (pc *PeerConnection) populateLocalCandidates(orig *SessionDescription) *SessionDescription {
-	if orig == nil {
-		return nil
-	} else if pc.iceGatherer == nil {
+	if iceGatherer, _, _ := pc.transports(); orig == nil || iceGatherer == nil {
 		return orig
 	}
 
-	candidates, err := pc.iceGatherer.GetLocalCandidates()
+	// The stored description is left untouched, candidates are added to a
+	// copy of it
+	parsed, err := unmarshalSessionDescription(orig.SDP)
 	if err != nil {
 		return orig
 	}
-
-	parsed := pc.pendingLocalDescription.parsed
 	for _, m := range parsed.MediaDescriptions {
-		addCandidatesToMediaDescriptions(candidates, m)
+		if m.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		gatherer := pc.iceGathererForMid(pc.getMidValue(m))
+		candidates, err := gatherer.GetLocalCandidates()
+		if err != nil {
+			return orig
+		}
+		addCandidatesToMediaDescriptions(candidates, m, gatherer.State() == ICEGathererStateComplete)
 	}
 	sdp, err := parsed.Marshal()
 	if err != nil {
@@ -1767,8 +3490,9 @@ func (pc *PeerConnection) populateLocalCandidates(orig *SessionDescription) *Ses
 	}
 
 	return &SessionDescription{
-		SDP:  string(sdp),
-		Type: pc.pendingLocalDescription.Type,
+		SDP:    string(sdp),
+		Type:   orig.Type,
+		parsed: parsed,
 	}
 }
 
@@ -1814,7 +3538,8 @@ func (pc *PeerConnection) SignalingState() SignalingState {
 // ICEGatheringState attribute returns the ICE gathering state of the
 // PeerConnection instance.
 func (pc *PeerConnection) ICEGatheringState() ICEGatheringState {
-	switch pc.iceGatherer.State() {
+	iceGatherer, _, _ := pc.transports()
+	switch iceGatherer.State() {
 	case ICEGathererStateNew:
 		return ICEGatheringStateNew
 	case ICEGathererStateGathering:
@@ -1827,6 +3552,9 @@ func (pc *PeerConnection) ICEGatheringState() ICEGatheringState {
 // ConnectionState attribute returns the connection state of the
 // PeerConnection instance.
 func (pc *PeerConnection) ConnectionState() PeerConnectionState {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
 	return pc.connectionState
 }
 
@@ -1872,16 +3600,18 @@ func (pc *PeerConnection) GetStats() StatsReport {
 	return statsCollector.Ready()
 }
 
-func addCandidatesToMediaDescriptions(candidates []ICECandidate, m *sdp.MediaDescription) {
+// addCandidatesToMediaDescriptions adds the candidates the media section
+// doesn't carry yet, and the end of candidates once gathering is complete.
+// Every m-line offers rtcp-mux, so only the RTP component is announced.
+func addCandidatesToMediaDescriptions(candidates []ICECandidate, m *sdp.MediaDescription, gatheringComplete bool) {
 	for _, c := range candidates {
 		sdpCandidate := iceCandidateToSDP(c)
 		sdpCandidate.ExtensionAttributes = append(sdpCandidate.ExtensionAttributes, sdp.ICECandidateAttribute{Key: "generation", Value: "0"})
-		sdpCandidate.Component = 1
-		m.WithICECandidate(sdpCandidate)
-		sdpCandidate.Component = 2
-		m.WithICECandidate(sdpCandidate)
+		if !mediaHasAttribute(m, "candidate", sdpCandidate.Marshal()) {
+			m.WithICECandidate(sdpCandidate)
+		}
 	}
-	if len(candidates) != 0 {
+	if gatheringComplete && !mediaHasAttribute(m, "end-of-candidates", "") {
 		m.WithPropertyAttribute("end-of-candidates")
 	}
 }
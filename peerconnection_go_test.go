@@ -6,11 +6,14 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
 	"math/big"
 	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -373,7 +376,7 @@ func TestPeerConnection_AnswerWithoutOffer(t *testing.T) {
 	}
 }
 
-func TestPeerConnection_satisfyTypeAndDirection(t *testing.T) {
+func TestPeerConnection_matchTransceiver(t *testing.T) {
 	createTransceiver := func(kind RTPCodecType, direction RTPTransceiverDirection) *RTPTransceiver {
 		return &RTPTransceiver{kind: kind, Direction: direction}
 	}
@@ -381,23 +384,20 @@ func TestPeerConnection_satisfyTypeAndDirection(t *testing.T) {
 	for _, test := range []struct {
 		name string
 
-		kinds      []RTPCodecType
-		directions []RTPTransceiverDirection
+		kinds []RTPCodecType
 
 		localTransceivers []*RTPTransceiver
 		want              []*RTPTransceiver
 	}{
 		{
-			"Audio and Video Transceivers can not satisfy each other",
+			"Audio and Video Transceivers can not match each other",
 			[]RTPCodecType{RTPCodecTypeVideo},
-			[]RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
 			[]*RTPTransceiver{createTransceiver(RTPCodecTypeAudio, RTPTransceiverDirectionSendrecv)},
 			[]*RTPTransceiver{createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionInactive)},
 		},
 		{
 			"No local Transceivers, every remote should get an inactive",
 			[]RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeAudio, RTPCodecTypeVideo, RTPCodecTypeVideo},
-			[]RTPTransceiverDirection{RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionInactive},
 
 			[]*RTPTransceiver{},
 
@@ -409,37 +409,25 @@ func TestPeerConnection_satisfyTypeAndDirection(t *testing.T) {
 			},
 		},
 		{
-			"Local Recv can satisfy remote SendRecv",
-			[]RTPCodecType{RTPCodecTypeVideo},
-			[]RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
-
-			[]*RTPTransceiver{createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)},
-
-			[]*RTPTransceiver{createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)},
-		},
-		{
-			"Don't satisify a Sendonly with a SendRecv, later SendRecv will be marked as Inactive",
-			[]RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeVideo},
-			[]RTPTransceiverDirection{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionSendrecv},
+			"Transceivers are matched in order, whatever their direction",
+			[]RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeAudio, RTPCodecTypeVideo},
 
 			[]*RTPTransceiver{
-				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv),
+				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly),
 				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly),
+				createTransceiver(RTPCodecTypeAudio, RTPTransceiverDirectionInactive),
 			},
 
 			[]*RTPTransceiver{
+				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly),
+				createTransceiver(RTPCodecTypeAudio, RTPTransceiverDirectionInactive),
 				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly),
-				createTransceiver(RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv),
 			},
 		},
 	} {
-		if len(test.kinds) != len(test.directions) {
-			t.Fatal("Kinds and Directions must be the same length")
-		}
-
 		got := []*RTPTransceiver{}
 		for i := range test.kinds {
-			res, filteredLocalTransceivers := satisfyTypeAndDirection(test.kinds[i], test.directions[i], test.localTransceivers)
+			res, filteredLocalTransceivers := matchTransceiver(test.kinds[i], test.localTransceivers)
 
 			got = append(got, res)
 			test.localTransceivers = filteredLocalTransceivers
@@ -455,7 +443,7 @@ func TestPeerConnection_satisfyTypeAndDirection(t *testing.T) {
 			for _, t := range test.want {
 				wantStr += fmt.Sprintf("%+v\n", t)
 			}
-			t.Errorf("satisfyTypeAndDirection %q: \ngot\n%s \nwant\n%s", test.name, gotStr, wantStr)
+			t.Errorf("matchTransceiver %q: \ngot\n%s \nwant\n%s", test.name, gotStr, wantStr)
 		}
 	}
 
@@ -488,6 +476,31 @@ func TestOneAttrKeyConnectionSetupPerMediaDescriptionInSDP(t *testing.T) {
 	assert.Len(t, matches, 5)
 }
 
+// Assert that only RTP candidates are announced, RTCP is always muxed
+func TestPeerConnection_CandidatesRTCPMux(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = pc.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+
+	for pc.iceGatherer.State() != ICEGathererStateComplete {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, offer.SDP, "a=rtcp-mux")
+
+	matches := regexp.MustCompile(`a=candidate:\S+ (\d+) `).FindAllStringSubmatch(offer.SDP, -1)
+	assert.NotEmpty(t, matches)
+	for _, match := range matches {
+		assert.Equal(t, "1", match[1])
+	}
+
+	assert.NoError(t, pc.Close())
+}
+
 // Assert that candidates are gathered by calling SetLocalDescription, not SetRemoteDescription
 // When trickle in on by default we can move this to peerconnection_test.go
 func TestGatherOnSetLocalDescription(t *testing.T) {
@@ -557,3 +570,850 @@ func TestGatherOnSetLocalDescription(t *testing.T) {
 
 	<-pcAnswerGathered
 }
+
+func TestPeerConnection_ICERestart(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dcOpened := make(chan struct{})
+	dc, err := pcOffer.CreateDataChannel("restart", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.OnOpen(func() {
+		close(dcOpened)
+	})
+
+	messageReceived := make(chan struct{})
+	pcAnswer.OnDataChannel(func(d *DataChannel) {
+		if d.Label() != "restart" {
+			return
+		}
+		d.OnMessage(func(msg DataChannelMessage) {
+			close(messageReceived)
+		})
+	})
+
+	if err = signalPair(pcOffer, pcAnswer); err != nil {
+		t.Fatal(err)
+	}
+	<-dcOpened
+
+	iceRestarted := make(chan struct{})
+	var once sync.Once
+	pcOffer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+		if state == ICEConnectionStateConnected {
+			once.Do(func() { close(iceRestarted) })
+		}
+	})
+
+	offerUfrag, _, _, err := extractICEDetails(pcOffer.LocalDescription().parsed)
+	assert.NoError(t, err)
+	answerUfrag, _, _, err := extractICEDetails(pcAnswer.LocalDescription().parsed)
+	assert.NoError(t, err)
+
+	offer, err := pcOffer.CreateOffer(&OfferOptions{ICERestart: true})
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	restartedOfferUfrag, _, _, err := extractICEDetails(offer.parsed)
+	assert.NoError(t, err)
+	assert.NotEqual(t, offerUfrag, restartedOfferUfrag)
+
+	restartedAnswerUfrag, _, _, err := extractICEDetails(answer.parsed)
+	assert.NoError(t, err)
+	assert.NotEqual(t, answerUfrag, restartedAnswerUfrag)
+
+	<-iceRestarted
+
+	// The SCTP association survived the restart
+	assert.NoError(t, dc.SendText("restarted"))
+	<-messageReceived
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_OnNegotiationNeeded(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	negotiationNeeded := make(chan struct{}, 10)
+	pcOffer.OnNegotiationNeeded(func() {
+		negotiationNeeded <- struct{}{}
+	})
+
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+	<-negotiationNeeded
+
+	// Coalesced with the data channel, the flag is still set
+	_, err = pcOffer.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	select {
+	case <-negotiationNeeded:
+		t.Fatal("OnNegotiationNeeded fired for changes that have been negotiated")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = pcOffer.AddTransceiver(RTPCodecTypeAudio)
+	assert.NoError(t, err)
+	<-negotiationNeeded
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_OnConnectionStateChange(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, PeerConnectionStateNew, pcOffer.ConnectionState())
+
+	connectionStates := make(chan PeerConnectionState, 10)
+	pcOffer.OnConnectionStateChange(func(state PeerConnectionState) {
+		connectionStates <- state
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	// Handlers run in their own goroutines, wait for connected whatever the
+	// order connecting got delivered in
+	for state := range connectionStates {
+		if state == PeerConnectionStateConnected {
+			break
+		}
+		assert.Equal(t, PeerConnectionStateConnecting, state)
+	}
+	assert.Equal(t, PeerConnectionStateConnected, pcOffer.ConnectionState())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.Equal(t, PeerConnectionStateClosed, pcOffer.ConnectionState())
+	for state := range connectionStates {
+		if state == PeerConnectionStateClosed {
+			break
+		}
+	}
+
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a lite agent only offers host candidates, and that the full
+// agent is controlling whichever side offers
+func TestPeerConnection_ICELite(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, liteOfferer := range []bool{true, false} {
+		liteSettings := SettingEngine{}
+		liteSettings.SetLite(true)
+		liteAPI := NewAPI(WithSettingEngine(liteSettings))
+
+		litePC, err := liteAPI.NewPeerConnection(Configuration{})
+		assert.NoError(t, err)
+		fullPC, err := NewPeerConnection(Configuration{})
+		assert.NoError(t, err)
+
+		pcOffer, pcAnswer := fullPC, litePC
+		if liteOfferer {
+			pcOffer, pcAnswer = litePC, fullPC
+		}
+
+		iceConnected := make(chan struct{})
+		var iceConnectedOnce sync.Once
+		pcOffer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+			if state == ICEConnectionStateConnected {
+				iceConnectedOnce.Do(func() { close(iceConnected) })
+			}
+		})
+
+		assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+		liteDesc := litePC.LocalDescription()
+		_, hasLite := liteDesc.parsed.Attribute("ice-lite")
+		assert.True(t, hasLite)
+		for _, m := range liteDesc.parsed.MediaDescriptions {
+			for _, a := range m.Attributes {
+				if a.IsICECandidate() {
+					candidate, candidateErr := a.ToICECandidate()
+					assert.NoError(t, candidateErr)
+					assert.Equal(t, "host", candidate.Typ)
+				}
+			}
+		}
+
+		<-iceConnected
+		assert.Equal(t, ICERoleControlled, litePC.iceTransport.Role())
+		assert.Equal(t, ICERoleControlling, fullPC.iceTransport.Role())
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+	}
+}
+
+func TestPeerConnection_PeerIdentity(t *testing.T) {
+	key := []byte("shared secret")
+
+	offerSettings := SettingEngine{}
+	offerSettings.AddIdentityProvider("example.org", NewLocalIdentityProvider("alice@example.org", key))
+	pcOffer, err := NewAPI(WithSettingEngine(offerSettings)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, &rtcerr.InvalidAccessError{Err: ErrUnknownIdentityProvider}, pcOffer.SetIdentityProvider("example.com"))
+
+	noIdentityOffer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, pcOffer.SetIdentityProvider("example.org"))
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	_, hasIdentity := offer.parsed.Attribute("identity")
+	assert.True(t, hasIdentity)
+
+	answerSettings := SettingEngine{}
+	answerSettings.AddIdentityProvider("example.org", NewLocalIdentityProvider("", key))
+	answerAPI := NewAPI(WithSettingEngine(answerSettings))
+
+	fingerprint, _ := offer.parsed.Attribute("fingerprint")
+	tamperedOffer := SessionDescription{
+		Type: SDPTypeOffer,
+		SDP:  regexp.MustCompile(`a=fingerprint:.*\r\n`).ReplaceAllString(offer.SDP, "a=fingerprint:sha-256 00:11:22\r\n"),
+	}
+	assert.NotEqual(t, "sha-256 00:11:22", fingerprint)
+
+	for _, testCase := range []struct {
+		peerIdentity string
+		offer        SessionDescription
+		expectedErr  error
+	}{
+		{"bob@example.org", offer, &rtcerr.OperationError{Err: ErrPeerIdentityMismatch}},
+		{"alice@example.org", noIdentityOffer, &rtcerr.OperationError{Err: ErrPeerIdentityMismatch}},
+		{"", tamperedOffer, &rtcerr.OperationError{Err: ErrIdentityValidationFailed}},
+		{"alice@example.org", offer, nil},
+	} {
+		pcAnswer, answerErr := answerAPI.NewPeerConnection(Configuration{PeerIdentity: testCase.peerIdentity})
+		assert.NoError(t, answerErr)
+
+		assert.Equal(t, testCase.expectedErr, pcAnswer.SetRemoteDescription(testCase.offer))
+		if testCase.expectedErr == nil {
+			assert.Equal(t, "alice@example.org", pcAnswer.PeerIdentity())
+		} else {
+			assert.Equal(t, "", pcAnswer.PeerIdentity())
+		}
+
+		assert.NoError(t, pcAnswer.Close())
+	}
+
+	assert.NoError(t, pcOffer.Close())
+}
+
+// Assert that a candidate pool is gathered ahead of time, used by the first
+// offer and signaled once SetLocalDescription is called
+func TestPeerConnection_ICECandidatePool(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	s := SettingEngine{}
+	s.SetTrickle(true)
+	api := NewAPI(WithSettingEngine(s))
+
+	pc, err := api.NewPeerConnection(Configuration{ICECandidatePoolSize: 1})
+	assert.NoError(t, err)
+
+	var candidatesMu sync.Mutex
+	candidates := []*ICECandidate{}
+	gatheringDone := make(chan struct{})
+	pc.OnICECandidate(func(c *ICECandidate) {
+		if c == nil {
+			close(gatheringDone)
+			return
+		}
+		candidatesMu.Lock()
+		candidates = append(candidates, c)
+		candidatesMu.Unlock()
+	})
+
+	for pc.iceGatherer.State() != ICEGathererStateComplete {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	candidatesMu.Lock()
+	assert.Empty(t, candidates, "pooled candidates must not be signaled before SetLocalDescription")
+	candidatesMu.Unlock()
+
+	_, err = pc.CreateDataChannel("initial_data_channel", nil)
+	assert.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, offer.SDP, "a=candidate:")
+
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	<-gatheringDone
+
+	candidatesMu.Lock()
+	assert.NotEmpty(t, candidates)
+	candidatesMu.Unlock()
+
+	assert.NoError(t, pc.Close())
+}
+
+// Assert that the candidate pool holds ICECandidatePoolSize ICEGatherers,
+// and that it is gathered again once the ICE configuration changes
+func TestPeerConnection_ICECandidatePoolSize(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	s := SettingEngine{}
+	s.SetTrickle(true)
+	api := NewAPI(WithSettingEngine(s))
+
+	pc, err := api.NewPeerConnection(Configuration{ICECandidatePoolSize: 3})
+	assert.NoError(t, err)
+	assert.Len(t, pc.candidatePool, 2)
+
+	for pc.iceGatherer.State() != ICEGathererStateComplete {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Relay candidates can't be gathered without ICE servers
+	assert.NoError(t, pc.SetConfiguration(Configuration{
+		ICECandidatePoolSize: 2,
+		ICETransportPolicy:   ICETransportPolicyRelay,
+	}))
+	assert.Len(t, pc.candidatePool, 1)
+
+	for pc.iceGatherer.State() != ICEGathererStateComplete {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = pc.CreateDataChannel("initial_data_channel", nil)
+	assert.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, offer.SDP, "a=candidate:")
+
+	assert.NoError(t, pc.Close())
+	assert.Empty(t, pc.candidatePool)
+}
+
+func TestPeerConnection_AddICECandidate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	pcOffer, pcAnswer, err := api.newPair()
+	assert.NoError(t, err)
+
+	candidate := ICECandidate{
+		Foundation: "foundation",
+		Priority:   128,
+		Address:    "1.0.0.1",
+		Protocol:   ICEProtocolUDP,
+		Port:       1234,
+		Typ:        ICECandidateTypeHost,
+		Component:  1,
+	}.ToJSON()
+
+	_, isInvalidState := pcAnswer.AddICECandidate(candidate).(*rtcerr.InvalidStateError)
+	assert.True(t, isInvalidState, "candidates can't be added before the remote description")
+
+	_, err = pcOffer.CreateDataChannel("initial_data_channel", nil)
+	assert.NoError(t, err)
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	localSDP := pcOffer.LocalDescription().SDP
+	assert.Equal(t, 1, strings.Count(localSDP, "a=end-of-candidates"))
+	assert.Equal(t, localSDP, pcOffer.LocalDescription().SDP, "local candidates must only be added once")
+
+	// The remote hasn't signaled all of its candidates yet
+	offer.SDP = strings.Replace(offer.SDP, "a=end-of-candidates\r\n", "", -1)
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	unknownMid := "unknown"
+	candidate.SDPMid = &unknownMid
+	_, isOperationError := pcAnswer.AddICECandidate(candidate).(*rtcerr.OperationError)
+	assert.True(t, isOperationError)
+
+	outOfRange := uint16(1)
+	candidate.SDPMid = nil
+	candidate.SDPMLineIndex = &outOfRange
+	_, isOperationError = pcAnswer.AddICECandidate(candidate).(*rtcerr.OperationError)
+	assert.True(t, isOperationError)
+
+	mid := pcAnswer.getMidValue(pcAnswer.RemoteDescription().parsed.MediaDescriptions[0])
+	candidate.SDPMid = &mid
+	handedOut := pcAnswer.PendingRemoteDescription()
+	assert.NoError(t, pcAnswer.AddICECandidate(candidate))
+	assert.Contains(t, pcAnswer.PendingRemoteDescription().SDP, "a=candidate:foundation 1 udp 128 1.0.0.1 1234 typ host")
+	assert.NotContains(t, pcAnswer.PendingRemoteDescription().SDP, "a=end-of-candidates")
+	assert.NotContains(t, handedOut.SDP, "a=candidate:foundation 1 udp 128 1.0.0.1 1234 typ host")
+
+	assert.NoError(t, pcAnswer.AddICECandidate(ICECandidateInit{Candidate: "", SDPMid: &mid}))
+	assert.Contains(t, pcAnswer.PendingRemoteDescription().SDP, "a=end-of-candidates")
+
+	// The description is updated in place, its SDP has to match it
+	reparsed, err := unmarshalSessionDescription(pcAnswer.PendingRemoteDescription().SDP)
+	assert.NoError(t, err)
+	assert.Equal(t, reparsed, pcAnswer.PendingRemoteDescription().parsed)
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.Contains(t, pcAnswer.CurrentRemoteDescription().SDP, "a=candidate:foundation 1 udp 128 1.0.0.1 1234 typ host")
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that the end of candidates reaches the ICETransport, which fails
+// once the checks of all the candidates it has been given failed
+func TestPeerConnection_AddICECandidate_EndOfCandidates(t *testing.T) {
+	lim := test.TimeOut(time.Second * 40)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := NewAPI().newPair()
+	assert.NoError(t, err)
+
+	iceFailed := make(chan struct{})
+	var iceFailedOnce sync.Once
+	pcAnswer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+		if state == ICEConnectionStateFailed {
+			iceFailedOnce.Do(func() { close(iceFailed) })
+		}
+	})
+
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	// The only candidate is one nobody answers on
+	trickledOffer := SessionDescription{Type: SDPTypeOffer}
+	for _, line := range strings.SplitAfter(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=candidate") && !strings.HasPrefix(line, "a=end-of-candidates") {
+			trickledOffer.SDP += line
+		}
+	}
+	assert.NoError(t, pcAnswer.SetRemoteDescription(trickledOffer))
+
+	mid := pcAnswer.getMidValue(pcAnswer.RemoteDescription().parsed.MediaDescriptions[0])
+	assert.NoError(t, pcAnswer.AddICECandidate(ICECandidateInit{
+		Candidate: "candidate:1 1 udp 2130706431 192.0.2.1 9 typ host",
+		SDPMid:    &mid,
+	}))
+	assert.NoError(t, pcAnswer.AddICECandidate(ICECandidateInit{Candidate: "", SDPMid: &mid}))
+
+	<-iceFailed
+	assert.Equal(t, ICEConnectionStateFailed, pcAnswer.ICEConnectionState())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_Rollback(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	assert.NoError(t, err)
+
+	assert.Error(t, pcOffer.SetLocalDescription(SessionDescription{Type: SDPTypeRollback}), "there is no offer to roll back")
+
+	transceiver, err := pcOffer.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NotEmpty(t, transceiver.Mid())
+
+	assert.NoError(t, pcOffer.SetLocalDescription(SessionDescription{Type: SDPTypeRollback}))
+	assert.Equal(t, SignalingStateStable, pcOffer.SignalingState())
+	assert.Nil(t, pcOffer.PendingLocalDescription())
+	assert.Empty(t, transceiver.Mid(), "the mid was assigned by the offer that has been rolled back")
+
+	// The remote offer is rolled back the same way, an answer to it
+	// doesn't keep the mids it has assigned
+	answerTransceiver, err := pcAnswer.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	_, err = pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, answerTransceiver.Mid())
+
+	assert.Error(t, pcAnswer.SetLocalDescription(SessionDescription{Type: SDPTypeRollback}), "the offer is a remote one")
+
+	// The transports started for the remote offer are replaced
+	iceTransport := pcAnswer.iceTransport
+	assert.NoError(t, pcAnswer.SetRemoteDescription(SessionDescription{Type: SDPTypeRollback}))
+	assert.Equal(t, SignalingStateStable, pcAnswer.SignalingState())
+	assert.Nil(t, pcAnswer.RemoteDescription())
+	assert.Empty(t, answerTransceiver.Mid())
+	assert.Nil(t, pcAnswer.sctpTransport)
+	assert.NotEqual(t, iceTransport, pcAnswer.iceTransport)
+	assert.Equal(t, pcAnswer.dtlsTransport, answerTransceiver.Sender.Transport())
+
+	// A provisional answer is rolled back by the side that applied the
+	// remote offer
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	pranswer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	pranswer.Type = SDPTypePranswer
+	assert.NoError(t, pcAnswer.SetLocalDescription(pranswer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(SessionDescription{Type: SDPTypeRollback}))
+	assert.Equal(t, SignalingStateStable, pcAnswer.SignalingState())
+	assert.Empty(t, answerTransceiver.Mid())
+
+	// Negotiation still works after both rollbacks
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.NotEmpty(t, transceiver.Mid())
+	assert.Equal(t, SignalingStateStable, pcOffer.SignalingState())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that the fingerprints of all certificates are announced, and that
+// the DTLS server uses the ECDSA one pion/dtls can sign with
+func TestPeerConnection_MultipleCertificates(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaCertificate, err := GenerateCertificate(rsaKey)
+	assert.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ecdsaCertificate, err := GenerateCertificate(ecdsaKey)
+	assert.NoError(t, err)
+
+	pcOffer, err := NewPeerConnection(Configuration{
+		Certificates: []Certificate{*rsaCertificate, *ecdsaCertificate},
+	})
+	assert.NoError(t, err)
+	pcAnswer, err := NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.Equal(t, 6, strings.Count(pcOffer.LocalDescription().SDP, "a=fingerprint:"))
+
+	// The answerer is the DTLS client, the RSA certificate is only announced
+	for pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ecdsaCertificate.x509Cert.Raw, pcAnswer.dtlsTransport.GetRemoteCertificate())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+
+	// A configuration DTLS can't use any certificate of is rejected upfront
+	_, err = NewPeerConnection(Configuration{Certificates: []Certificate{*rsaCertificate}})
+	assert.Equal(t, &rtcerr.InvalidAccessError{Err: ErrNoECDSACertificate}, err)
+}
+
+// Assert that the answerer takes the DTLS role set by the SettingEngine,
+// and that an answer leaving the role open is rejected
+func TestPeerConnection_AnsweringDTLSRole(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	assert.Error(t, s.SetAnsweringDTLSRole(DTLSRoleAuto))
+	assert.NoError(t, s.SetAnsweringDTLSRole(DTLSRoleServer))
+
+	pcOffer, err := NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+	pcAnswer, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, DTLSRoleAuto, pcAnswer.dtlsTransport.Role())
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.Contains(t, pcAnswer.LocalDescription().SDP, "a=setup:passive")
+	assert.NotContains(t, pcAnswer.LocalDescription().SDP, "a=setup:active")
+
+	for pcOffer.dtlsTransport.State() != DTLSTransportStateConnected ||
+		pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, DTLSRoleClient, pcOffer.dtlsTransport.Role())
+	assert.Equal(t, DTLSRoleServer, pcAnswer.dtlsTransport.Role())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+
+	pcOffer, pcAnswer, err = NewAPI().newPair()
+	assert.NoError(t, err)
+
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+
+	answer.SDP = strings.Replace(answer.SDP, "a=setup:active", "a=setup:actpass", -1)
+	err = pcOffer.SetRemoteDescription(answer)
+	assert.Error(t, err)
+	_, ok := err.(*rtcerr.InvalidAccessError)
+	assert.True(t, ok)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that renegotiation keeps the DTLS role of the running association,
+// whichever end offers
+func TestPeerConnection_RenegotiationDTLSRole(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := NewAPI().newPair()
+	assert.NoError(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	for pcOffer.dtlsTransport.State() != DTLSTransportStateConnected ||
+		pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, DTLSRoleServer, pcOffer.dtlsTransport.Role())
+	assert.Equal(t, DTLSRoleClient, pcAnswer.dtlsTransport.Role())
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+
+	swapped := answer
+	swapped.SDP = strings.Replace(answer.SDP, "a=setup:active", "a=setup:passive", -1)
+	err = pcOffer.SetRemoteDescription(swapped)
+	assert.Error(t, err)
+	_, ok := err.(*rtcerr.InvalidAccessError)
+	assert.True(t, ok)
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	// The former answerer offers, the DTLS server has to stay passive
+	offer, err = pcAnswer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(offer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(offer))
+	answer, err = pcOffer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, answer.SDP, "a=setup:passive")
+	assert.NotContains(t, answer.SDP, "a=setup:active")
+	assert.NoError(t, pcOffer.SetLocalDescription(answer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(answer))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that the SRTP sessions are keyed with the protection profile the
+// DTLS handshake selected
+func TestPeerConnection_SRTPProtectionProfiles(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	assert.NoError(t, s.SetSRTPProtectionProfiles(SRTPProtectionProfileAES128CMHMACSHA180))
+
+	pcOffer, pcAnswer, err := NewAPI(WithSettingEngine(s)).newPair()
+	assert.NoError(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	for pcOffer.dtlsTransport.State() != DTLSTransportStateConnected ||
+		pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, SRTPProtectionProfileAES128CMHMACSHA180, pcOffer.dtlsTransport.srtpProtectionProfile)
+	assert.Equal(t, SRTPProtectionProfileAES128CMHMACSHA180, pcAnswer.dtlsTransport.srtpProtectionProfile)
+
+	_, err = pcOffer.dtlsTransport.getSRTPSession()
+	assert.NoError(t, err)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that both ends report the same DTLS session, and derive the same
+// keying material from it
+func TestPeerConnection_DTLSConnectionState(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := NewAPI().newPair()
+	assert.NoError(t, err)
+
+	_, err = pcOffer.dtlsTransport.ConnectionState()
+	assert.Error(t, err)
+	_, err = pcOffer.dtlsTransport.ExportKeyingMaterial("EXTRACTOR-test", nil, 32)
+	assert.Error(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	for pcOffer.dtlsTransport.State() != DTLSTransportStateConnected ||
+		pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	offerState, err := pcOffer.dtlsTransport.ConnectionState()
+	assert.NoError(t, err)
+	answerState, err := pcAnswer.dtlsTransport.ConnectionState()
+	assert.NoError(t, err)
+
+	assert.Equal(t, DTLSRoleServer, offerState.Role)
+	assert.Equal(t, DTLSRoleClient, answerState.Role)
+	assert.NotZero(t, offerState.CipherSuite)
+	assert.Equal(t, offerState.CipherSuite, answerState.CipherSuite)
+	assert.Equal(t, SRTPProtectionProfileAES128CMHMACSHA180, offerState.SRTPProtectionProfile)
+	assert.Equal(t, offerState.SRTPProtectionProfile, answerState.SRTPProtectionProfile)
+	if assert.Len(t, answerState.RemoteCertificates, 1) {
+		assert.Equal(t, pcOffer.configuration.Certificates[0].x509Cert.Raw, answerState.RemoteCertificates[0].Raw)
+	}
+
+	offerKeys, err := pcOffer.dtlsTransport.ExportKeyingMaterial("EXTRACTOR-test", nil, 32)
+	assert.NoError(t, err)
+	answerKeys, err := pcAnswer.dtlsTransport.ExportKeyingMaterial("EXTRACTOR-test", nil, 32)
+	assert.NoError(t, err)
+	assert.Len(t, offerKeys, 32)
+	assert.Equal(t, offerKeys, answerKeys)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a rejected remote certificate fails the DTLSTransport before
+// it reports connected, and that the error is surfaced by the PeerConnection
+func TestPeerConnection_DTLSVerifyPeerCertificate(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	pinned, err := GenerateCertificate(sk)
+	assert.NoError(t, err)
+	pinnedRejected := fmt.Errorf("certificate isn't pinned")
+
+	s := SettingEngine{}
+	s.SetDTLSVerifyPeerCertificate(func(remoteCertificate *x509.Certificate) error {
+		if !remoteCertificate.Equal(pinned.x509Cert) {
+			return pinnedRejected
+		}
+		return nil
+	})
+	pcOffer, err := NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+	pcAnswer, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	errChan := make(chan error, 1)
+	pcAnswer.OnError(func(err error) {
+		errChan <- err
+	})
+
+	var connected bool
+	var connectedMu sync.Mutex
+	failedChan := make(chan struct{})
+	pcAnswer.OnConnectionStateChange(func(state PeerConnectionState) {
+		switch state {
+		case PeerConnectionStateConnected:
+			connectedMu.Lock()
+			connected = true
+			connectedMu.Unlock()
+		case PeerConnectionStateFailed:
+			close(failedChan)
+		}
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.Equal(t, pinnedRejected, <-errChan)
+	<-failedChan
+
+	assert.Equal(t, DTLSTransportStateFailed, pcAnswer.dtlsTransport.State())
+	connectedMu.Lock()
+	assert.False(t, connected, "the PeerConnection reported connected to an unauthenticated peer")
+	connectedMu.Unlock()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+
+	// The pinned certificate is accepted
+	pcOffer, err = NewPeerConnection(Configuration{Certificates: []Certificate{*pinned}})
+	assert.NoError(t, err)
+	pcAnswer, err = NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	for pcAnswer.dtlsTransport.State() != DTLSTransportStateConnected {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
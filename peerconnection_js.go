@@ -21,6 +21,7 @@ type PeerConnection struct {
 	onSignalingStateChangeHandler    *js.Func
 	onDataChannelHandler             *js.Func
 	onICEConectionStateChangeHandler *js.Func
+	onConnectionStateChangeHandler   *js.Func
 	onICECandidateHandler            *js.Func
 	onICEGatheringStateChangeHandler *js.Func
 
@@ -111,6 +112,22 @@ func (pc *PeerConnection) OnICEConnectionStateChange(f func(ICEConnectionState))
 	pc.underlying.Set("oniceconnectionstatechange", onICEConectionStateChangeHandler)
 }
 
+// OnConnectionStateChange sets an event handler which is called
+// when the PeerConnectionState has changed
+func (pc *PeerConnection) OnConnectionStateChange(f func(PeerConnectionState)) {
+	if pc.onConnectionStateChangeHandler != nil {
+		oldHandler := pc.onConnectionStateChangeHandler
+		defer oldHandler.Release()
+	}
+	onConnectionStateChangeHandler := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		connectionState := newPeerConnectionState(pc.underlying.Get("connectionState").String())
+		go f(connectionState)
+		return js.Undefined()
+	})
+	pc.onConnectionStateChangeHandler = &onConnectionStateChangeHandler
+	pc.underlying.Set("onconnectionstatechange", onConnectionStateChangeHandler)
+}
+
 func (pc *PeerConnection) checkConfiguration(configuration Configuration) error {
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-setconfiguration (step #2)
 	if pc.ConnectionState() == PeerConnectionStateClosed {
@@ -392,6 +409,9 @@ func (pc *PeerConnection) Close() (err error) {
 	if pc.onICEConectionStateChangeHandler != nil {
 		pc.onICEConectionStateChangeHandler.Release()
 	}
+	if pc.onConnectionStateChangeHandler != nil {
+		pc.onConnectionStateChangeHandler.Release()
+	}
 	if pc.onICECandidateHandler != nil {
 		pc.onICECandidateHandler.Release()
 	}
@@ -4,6 +4,7 @@ package webrtc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
@@ -18,6 +19,7 @@ import (
 	"github.com/pion/sdp/v2"
 	"github.com/pion/transport/test"
 	"github.com/hcm007/webrtc/v2/pkg/media"
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -632,6 +634,9 @@ func TestOfferRejectionMissingCodec(t *testing.T) {
 	if got, want := videoDesc.MediaName.Formats, []string{"0"}; !reflect.DeepEqual(got, want) {
 		t.Fatalf("rejecting unknown codec: sdp m=%s, want trailing 0", *videoDesc.MediaName.String())
 	}
+
+	assert.NoError(t, pc.Close())
+	assert.NoError(t, noCodecPC.Close())
 }
 
 func TestAddTransceiverFromTrackSendOnly(t *testing.T) {
@@ -796,29 +801,78 @@ func TestAddTransceiverFromKind(t *testing.T) {
 	}
 }
 
-func TestAddTransceiverFromKindFailsSendOnly(t *testing.T) {
-
+func TestAddTransceiverFromKindSendOnly(t *testing.T) {
 	pc, err := NewPeerConnection(Configuration{})
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
 	}
 
 	transceiver, err := pc.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{
 		Direction: RTPTransceiverDirectionSendonly,
 	})
-
-	if transceiver != nil {
-		t.Error("AddTransceiverFromKind shouldn't succeed with Direction RTPTransceiverDirectionSendonly")
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	assert.NotNil(t, err)
+	assert.Nil(t, transceiver.Receiver)
+	assert.NotNil(t, transceiver.Sender)
+	assert.NotNil(t, transceiver.Sender.Track())
+
+	// The track can be bound later on
+	track, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	assert.NoError(t, transceiver.Sender.ReplaceTrack(track))
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.True(t, offerMediaHasDirection(offer, RTPCodecTypeVideo, RTPTransceiverDirectionSendonly))
+	assert.Equal(t, []string{fmt.Sprint(track.SSRC())}, extractSsrcList(offer.parsed.MediaDescriptions[0]))
+
+	assert.NoError(t, pc.Close())
 }
 
-func TestAddTransceiverFromTrackFailsRecvOnly(t *testing.T) {
+func TestAddTransceiverFromKindInactive(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transceiver, err := pc.AddTransceiverFromKind(RTPCodecTypeAudio, RtpTransceiverInit{
+		Direction: RTPTransceiverDirectionInactive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, transceiver.Receiver)
+	assert.Nil(t, transceiver.Sender)
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.True(t, offerMediaHasDirection(offer, RTPCodecTypeAudio, RTPTransceiverDirectionInactive))
+
+	_, err = pc.AddTransceiverFromKind(RTPCodecTypeAudio, RtpTransceiverInit{
+		Direction: RTPTransceiverDirection(Unknown),
+	})
+	assert.Error(t, err)
+
+	// AddTrack gives the placeholder a Sender instead of adding a transceiver
+	track, err := pc.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	assert.NoError(t, err)
+	sender, err := pc.AddTrack(track)
+	assert.NoError(t, err)
+	assert.Equal(t, transceiver.Sender, sender)
+	assert.Equal(t, track, sender.Track())
+	assert.Equal(t, RTPTransceiverDirectionSendonly, transceiver.Direction)
+	assert.Equal(t, 1, len(pc.GetTransceivers()))
+
+	assert.NoError(t, pc.Close())
+}
 
+func TestAddTransceiverFromTrackRecvOnly(t *testing.T) {
 	pc, err := NewPeerConnection(Configuration{})
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
 	}
 
 	track, err := pc.NewTrack(
@@ -827,18 +881,997 @@ func TestAddTransceiverFromTrackFailsRecvOnly(t *testing.T) {
 		"track-id",
 		"track-label",
 	)
-
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
 	}
 
 	transceiver, err := pc.AddTransceiverFromTrack(track, RtpTransceiverInit{
 		Direction: RTPTransceiverDirectionRecvonly,
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotNil(t, transceiver.Receiver)
+	assert.Equal(t, track, transceiver.Sender.Track())
+
+	// The track is held but not announced until the direction allows sending
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.True(t, offerMediaHasDirection(offer, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+	assert.Empty(t, extractSsrcList(offer.parsed.MediaDescriptions[0]))
+
+	assert.NoError(t, transceiver.SetDirection(RTPTransceiverDirectionSendrecv))
+	offer, err = pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprint(0xDEADBEEF)}, extractSsrcList(offer.parsed.MediaDescriptions[0]))
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestAddTransceiverFromTrackInactive(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := pc.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transceiver, err := pc.AddTransceiverFromTrack(track, RtpTransceiverInit{
+		Direction: RTPTransceiverDirectionInactive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, transceiver.Receiver)
+	assert.Equal(t, track, transceiver.Sender.Track())
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.True(t, offerMediaHasDirection(offer, RTPCodecTypeAudio, RTPTransceiverDirectionInactive))
+	assert.Empty(t, extractSsrcList(offer.parsed.MediaDescriptions[0]))
+
+	assert.NoError(t, pc.Close())
+}
+
+// Assert that a track added after the PeerConnection is connected is
+// delivered to the remote once both sides have renegotiated
+func TestPeerConnection_Renegotiation_AddTrack(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+		t.Fatal(err)
+	}
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+	})
+
+	if err = signalPair(pcOffer, pcAnswer); err != nil {
+		t.Fatal(err)
+	}
+
+	vp8Track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pcOffer.AddTrack(vp8Track); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, vp8Track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
 
-	if transceiver != nil {
-		t.Error("AddTransceiverFromTrack shouldn't succeed with Direction RTPTransceiverDirectionRecvonly")
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a replaced track is received as a continuation of the
+// original one
+func TestPeerConnection_Media_ReplaceTrack(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo); err != nil {
+		t.Fatal(err)
 	}
 
-	assert.NotNil(t, err)
+	firstTrack, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "first", "pion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondTrack, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "second", "pion")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := pcOffer.AddTrack(firstTrack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	replacedReceived, replacedReceivedFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+
+		for {
+			p, routineErr := track.ReadRTP()
+			if routineErr != nil {
+				return
+			}
+
+			if bytes.Equal(p.Payload, []byte{0x10, 0xAA}) {
+				assert.Equal(t, firstTrack.SSRC(), p.SSRC)
+				replacedReceivedFunc()
+			}
+		}
+	})
+
+	if err = signalPair(pcOffer, pcAnswer); err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, firstTrack.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, sender.ReplaceTrack(secondTrack))
+	assert.Equal(t, secondTrack, sender.Track())
+	assert.Equal(t, io.ErrClosedPipe, firstTrack.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, secondTrack.WriteSample(media.Sample{Data: []byte{0xAA}, Samples: 1}))
+			case <-replacedReceived.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_RemoveTrack(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, pc.RemoveTrack(sender))
+	assert.Nil(t, sender.Track())
+	assert.Equal(t, RTPTransceiverDirectionRecvonly, pc.GetTransceivers()[0].Direction)
+
+	// Removing it again is a no-op
+	assert.NoError(t, pc.RemoveTrack(sender))
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.True(t, offerMediaHasDirection(offer, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+
+	otherPC, err := NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSender, err := otherPC.AddTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, pc.RemoveTrack(otherSender))
+
+	assert.NoError(t, pc.Close())
+	assert.NoError(t, otherPC.Close())
+}
+
+// Assert that a direction change is negotiated, and that the answer only
+// carries the directions both sides allow
+func TestRTPTransceiver_SetDirection(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offerTrack, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(offerTrack)
+	assert.NoError(t, err)
+
+	answerTrack, err := pcAnswer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTrack(answerTrack)
+	assert.NoError(t, err)
+
+	negotiate := func() SessionDescription {
+		offer, offerErr := pcOffer.CreateOffer(nil)
+		assert.NoError(t, offerErr)
+		assert.NoError(t, pcOffer.SetLocalDescription(offer))
+		assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+		answer, answerErr := pcAnswer.CreateAnswer(nil)
+		assert.NoError(t, answerErr)
+		assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+		assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+		return answer
+	}
+
+	offerTransceiver := pcOffer.GetTransceivers()[0]
+	assert.Equal(t, RTPTransceiverDirection(Unknown), offerTransceiver.CurrentDirection())
+
+	negotiate()
+	answerTransceiver := pcAnswer.GetTransceivers()[0]
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, offerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, answerTransceiver.CurrentDirection())
+
+	// Put the media on hold
+	assert.NoError(t, offerTransceiver.SetDirection(RTPTransceiverDirectionSendonly))
+	answer := negotiate()
+	assert.True(t, offerMediaHasDirection(answer, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+	assert.Equal(t, RTPTransceiverDirectionSendonly, offerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirectionRecvonly, answerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, answerTransceiver.Direction)
+	assert.True(t, answerTransceiver.Sender.isPaused())
+
+	// And resume it again
+	assert.NoError(t, offerTransceiver.SetDirection(RTPTransceiverDirectionSendrecv))
+	answer = negotiate()
+	assert.True(t, offerMediaHasDirection(answer, RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv))
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, offerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, answerTransceiver.CurrentDirection())
+	assert.False(t, answerTransceiver.Sender.isPaused())
+
+	assert.Error(t, offerTransceiver.SetDirection(RTPTransceiverDirection(Unknown)))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that with several media sections of the same kind every track is
+// delivered to the transceiver of the section that announced it
+func TestPeerConnection_Media_RouteByMid(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracks := []*Track{}
+	trackMids := map[string]string{}
+	var trackMidsMu sync.Mutex
+	for _, label := range []string{"camera1", "camera2"} {
+		track, trackErr := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), label, label)
+		if trackErr != nil {
+			t.Fatal(trackErr)
+		}
+
+		if _, err = pcOffer.AddTrack(track); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, track)
+
+		if _, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var onTrackCount sync.WaitGroup
+	onTrackCount.Add(len(tracks))
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		for _, transceiver := range pcAnswer.GetTransceivers() {
+			if transceiver.Receiver == r {
+				trackMidsMu.Lock()
+				assert.Equal(t, trackMids[track.Label()], transceiver.Mid())
+				trackMidsMu.Unlock()
+			}
+		}
+		onTrackCount.Done()
+	})
+
+	if err = signalPair(pcOffer, pcAnswer); err != nil {
+		t.Fatal(err)
+	}
+
+	trackMidsMu.Lock()
+	for i, transceiver := range pcOffer.GetTransceivers() {
+		assert.NotEmpty(t, transceiver.Mid())
+		assert.Equal(t, transceiver.Mid(), pcAnswer.GetTransceivers()[i].Mid())
+		trackMids[transceiver.Sender.Track().Label()] = transceiver.Mid()
+	}
+	trackMidsMu.Unlock()
+
+	allTracksFired := make(chan struct{})
+	go func() {
+		onTrackCount.Wait()
+		close(allTracksFired)
+	}()
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				for _, track := range tracks {
+					assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+				}
+			case <-allTracksFired:
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a stopped transceiver rejects its m-line, and that the
+// m-line is recycled by the next transceiver added
+func TestRTPTransceiver_Stop_RejectsMediaSection(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	negotiate := func() SessionDescription {
+		offer, offerErr := pcOffer.CreateOffer(nil)
+		assert.NoError(t, offerErr)
+		assert.NoError(t, pcOffer.SetLocalDescription(offer))
+		assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+		answer, answerErr := pcAnswer.CreateAnswer(nil)
+		assert.NoError(t, answerErr)
+		assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+		assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+		return offer
+	}
+
+	transceiver, err := pcOffer.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+	negotiate()
+	assert.Equal(t, transceiver.Mid(), pcAnswer.GetTransceivers()[0].Mid())
+
+	assert.NoError(t, transceiver.Stop())
+	offer := negotiate()
+
+	media := offer.parsed.MediaDescriptions[0]
+	assert.Equal(t, 0, media.MediaName.Port.Value)
+	mid, _ := media.Attribute(sdp.AttrKeyMID)
+	assert.Equal(t, transceiver.Mid(), mid)
+	bundle, _ := offer.parsed.Attribute(sdp.AttrKeyGroup)
+	assert.NotContains(t, strings.Fields(bundle), mid)
+
+	assert.Empty(t, pcOffer.GetTransceivers())
+	assert.Empty(t, pcAnswer.GetTransceivers())
+
+	// A new transceiver takes over the rejected m-line, with a new mid
+	recycled, err := pcOffer.AddTransceiver(RTPCodecTypeAudio)
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTransceiver(RTPCodecTypeAudio, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+	offer = negotiate()
+
+	assert.Equal(t, 2, len(offer.parsed.MediaDescriptions))
+	media = offer.parsed.MediaDescriptions[0]
+	assert.Equal(t, RTPCodecTypeAudio.String(), media.MediaName.Media)
+	assert.NotEqual(t, 0, media.MediaName.Port.Value)
+	recycledMid, _ := media.Attribute(sdp.AttrKeyMID)
+	assert.Equal(t, recycled.Mid(), recycledMid)
+	assert.NotEqual(t, mid, recycledMid)
+	assert.Equal(t, recycledMid, pcAnswer.GetTransceivers()[0].Mid())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a max-compat offer gives every m-line its own transports, and
+// that media flows when the answerer doesn't accept BUNDLE
+func TestPeerConnection_Media_MaxCompatUnbundled(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcOffer, err := api.NewPeerConnection(Configuration{BundlePolicy: BundlePolicyMaxCompat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcAnswer, err := api.NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := pcOffer.AddTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+		t.Fatal(err)
+	}
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hasGroup := offer.parsed.Attribute(sdp.AttrKeyGroup)
+	assert.True(t, hasGroup)
+
+	ufrags := map[string]bool{}
+	for _, m := range offer.parsed.MediaDescriptions {
+		ufrag, _ := m.Attribute("ice-ufrag")
+		assert.False(t, ufrags[ufrag], "m-lines must not share ICE credentials")
+		ufrags[ufrag] = true
+	}
+
+	if err = pcOffer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act as an answerer that doesn't support BUNDLE
+	unbundledOffer := SessionDescription{Type: SDPTypeOffer}
+	for _, line := range strings.SplitAfter(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=group:BUNDLE") {
+			unbundledOffer.SDP += line
+		}
+	}
+	if err = pcAnswer.SetRemoteDescription(unbundledOffer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hasGroup = answer.parsed.Attribute(sdp.AttrKeyGroup)
+	assert.False(t, hasGroup)
+
+	if err = pcAnswer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err = pcOffer.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NotEqual(t, pcOffer.dtlsTransport, sender.Transport())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that BundlePolicyBalanced offers a transport of its own to the first
+// m-section of every media type, and only negotiates those without BUNDLE
+func TestPeerConnection_Media_BalancedUnbundled(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracks := []*Track{}
+	for _, id := range []string{"first", "second"} {
+		track, trackErr := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), id, "pion")
+		if trackErr != nil {
+			t.Fatal(trackErr)
+		}
+		if _, err = pcOffer.AddTrack(track); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, track)
+	}
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second video m-section shares the transport of the data m-section
+	ufrags := []string{}
+	for _, m := range offer.parsed.MediaDescriptions {
+		ufrag, _ := m.Attribute("ice-ufrag")
+		ufrags = append(ufrags, ufrag)
+	}
+	assert.Equal(t, 3, len(ufrags))
+	assert.NotEqual(t, ufrags[0], ufrags[2])
+	assert.Equal(t, ufrags[1], ufrags[2])
+
+	if err = pcOffer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act as an answerer that doesn't support BUNDLE
+	unbundledOffer := SessionDescription{Type: SDPTypeOffer}
+	for _, line := range strings.SplitAfter(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=group:BUNDLE") {
+			unbundledOffer.SDP += line
+		}
+	}
+	if err = pcAnswer.SetRemoteDescription(unbundledOffer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pcAnswer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err = pcOffer.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	transceivers := pcOffer.GetTransceivers()
+	assert.False(t, transceivers[0].isStopped())
+	assert.True(t, transceivers[1].isStopped())
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, tracks[0].WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that the transports of an unbundled m-section drive the
+// PeerConnectionState too, a failed DTLS handshake on the second m-section
+// fails the PeerConnection while the first one connects
+func TestPeerConnection_Media_UnbundledTransportFailed(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcOffer, err := api.NewPeerConnection(Configuration{BundlePolicy: BundlePolicyMaxCompat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcAnswer, err := api.NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		if _, err = pcOffer.AddTransceiver(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed := make(chan struct{})
+	var failedOnce sync.Once
+	pcOffer.OnConnectionStateChange(func(state PeerConnectionState) {
+		if state == PeerConnectionStateFailed {
+			failedOnce.Do(func() { close(failed) })
+		}
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pcOffer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act as an answerer that doesn't support BUNDLE
+	unbundledOffer := SessionDescription{Type: SDPTypeOffer}
+	for _, line := range strings.SplitAfter(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=group:BUNDLE") {
+			unbundledOffer.SDP += line
+		}
+	}
+	if err = pcAnswer.SetRemoteDescription(unbundledOffer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pcAnswer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the video m-section announces a certificate the answerer
+	// doesn't have
+	sections := strings.Split(answer.SDP, "\r\nm=")
+	assert.True(t, strings.HasPrefix(sections[2], "video "))
+	sections[2] = strings.Replace(sections[2], "\r\na=", "\r\na=fingerprint:sha-256 "+
+		strings.TrimSuffix(strings.Repeat("00:", 32), ":")+"\r\na=", 1)
+	badAnswer := SessionDescription{Type: SDPTypeAnswer, SDP: strings.Join(sections, "\r\nm=")}
+	if err = pcOffer.SetRemoteDescription(badAnswer); err != nil {
+		t.Fatal(err)
+	}
+
+	<-failed
+	assert.Equal(t, PeerConnectionStateFailed, pcOffer.ConnectionState())
+	assert.NotEqual(t, DTLSTransportStateFailed, pcOffer.dtlsTransport.State())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a provisional answer starts early media, and that the final
+// answer updates the directions it negotiated
+func TestPeerConnection_Media_Pranswer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offerTrack, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(offerTrack)
+	assert.NoError(t, err)
+
+	answerTrack, err := pcAnswer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTrack(answerTrack)
+	assert.NoError(t, err)
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	// Early media only flows from the caller
+	answerTransceiver := pcAnswer.GetTransceivers()[0]
+	assert.NoError(t, answerTransceiver.SetDirection(RTPTransceiverDirectionRecvonly))
+
+	pranswer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	pranswer.Type = SDPTypePranswer
+	assert.NoError(t, pcAnswer.SetLocalDescription(pranswer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(pranswer))
+	assert.Equal(t, SignalingStateHaveLocalPranswer, pcAnswer.SignalingState())
+	assert.Equal(t, SignalingStateHaveRemotePranswer, pcOffer.SignalingState())
+
+	// Only the final answer sets the currentDirection
+	offerTransceiver := pcOffer.GetTransceivers()[0]
+	assert.Equal(t, RTPTransceiverDirection(Unknown), offerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirection(Unknown), answerTransceiver.CurrentDirection())
+	assert.False(t, offerTransceiver.Sender.isPaused())
+	assert.True(t, answerTransceiver.Sender.isPaused())
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, offerTrack.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	// The call is picked up
+	assert.NoError(t, answerTransceiver.SetDirection(RTPTransceiverDirectionSendrecv))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+	assert.Equal(t, SignalingStateStable, pcAnswer.SignalingState())
+	assert.Equal(t, SignalingStateStable, pcOffer.SignalingState())
+
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, offerTransceiver.CurrentDirection())
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, answerTransceiver.CurrentDirection())
+	assert.False(t, answerTransceiver.Sender.isPaused())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that media flows as plain RTP/AVPF, without DTLS or data channels,
+// when both ends enable SetInsecurePlainRTP
+func TestPeerConnection_Media_InsecurePlainRTP(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	s.SetInsecurePlainRTP(true)
+	api := NewAPI(WithSettingEngine(s))
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.Equal(t, &rtcerr.NotSupportedError{Err: ErrDataChannelsUnavailable}, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		pkt, readErr := track.ReadRTP()
+		assert.NoError(t, readErr)
+		assert.Equal(t, uint8(DefaultPayloadTypeVP8), pkt.PayloadType)
+		onTrackFiredFunc()
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, offer.SDP, "a=fingerprint")
+	assert.NotContains(t, offer.SDP, "a=setup")
+	assert.NotContains(t, offer.SDP, "m=application")
+	assert.Contains(t, offer.SDP, "m=video 9 RTP/AVPF")
+
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, answer.SDP, "a=fingerprint")
+	assert.Contains(t, answer.SDP, "m=video 9 RTP/AVPF")
+
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	_, err = pcOffer.dtlsTransport.ConnectionState()
+	assert.Equal(t, &rtcerr.InvalidStateError{Err: ErrDTLSTransportNotConnected}, err)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that an RTP/AVP offer is answered with RTP/AVP, without the RTCP
+// feedback only RTP/AVPF can carry, and that media flows
+func TestPeerConnection_Media_InsecurePlainRTP_AVPOffer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	s.SetInsecurePlainRTP(true)
+	api := NewAPI(WithSettingEngine(s))
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcOffer, pcAnswer, err := api.newPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTransceiver(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	onTrackFired, onTrackFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFiredFunc()
+	})
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+
+	// Act as an RTP/AVP endpoint
+	avpOffer := SessionDescription{Type: SDPTypeOffer}
+	for _, line := range strings.SplitAfter(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=rtcp-fb") {
+			avpOffer.SDP += strings.Replace(line, "RTP/AVPF", "RTP/AVP", 1)
+		}
+	}
+	assert.NoError(t, pcAnswer.SetRemoteDescription(avpOffer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, answer.SDP, "m=video 9 RTP/AVP ")
+	assert.NotContains(t, answer.SDP, "RTP/AVPF")
+	assert.NotContains(t, answer.SDP, "a=rtcp-fb")
+
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// An offer that needs DTLS is answered with its m-lines rejected
+func TestPeerConnection_Media_InsecurePlainRTP_SecureOffer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, err := api.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	s := SettingEngine{}
+	s.SetInsecurePlainRTP(true)
+	insecureAPI := NewAPI(WithSettingEngine(s))
+	insecureAPI.mediaEngine.RegisterDefaultCodecs()
+	pcAnswer, err := insecureAPI.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = pcOffer.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, answer.SDP, "m=video 0 UDP/TLS/RTP/SAVPF")
+	assert.Contains(t, answer.SDP, "m=application 0 DTLS/SCTP 5000")
+	assert.NotContains(t, answer.SDP, "RTP/AVPF")
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
 }
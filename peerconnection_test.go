@@ -354,6 +354,9 @@ func TestCreateOfferAnswer(t *testing.T) {
 	if err != nil {
 		t.Errorf("SetRemoteDescription (Originator): got error: %v", err)
 	}
+
+	assert.NoError(t, offerPeerConn.Close())
+	assert.NoError(t, answerPeerConn.Close())
 }
 
 func TestPeerConnection_EventHandlers(t *testing.T) {
@@ -428,6 +431,9 @@ func TestPeerConnection_EventHandlers(t *testing.T) {
 	case <-timeout:
 		t.Fatalf("timed out waiting for one or more events handlers to be called (these *were* called: %+v)", wasCalled)
 	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
 }
 
 func TestMultipleOfferAnswer(t *testing.T) {
@@ -0,0 +1,148 @@
+// +build !js
+
+package webrtc
+
+import (
+	"sync"
+)
+
+// PerfectNegotiator implements the "perfect negotiation" pattern on top of
+// a PeerConnection: both peers negotiate whenever OnNegotiationNeeded
+// fires, and offer collisions are resolved by giving one of them, the
+// polite peer, the role of rolling back its own offer. The impolite peer
+// ignores the colliding offer of the polite one.
+// https://www.w3.org/TR/webrtc/#perfect-negotiation-example
+type PerfectNegotiator struct {
+	mu sync.Mutex
+
+	pc     *PeerConnection
+	polite bool
+	signal func(SessionDescription) error
+
+	ignoreOffer bool
+	onError     func(error)
+}
+
+// NewPerfectNegotiator creates a PerfectNegotiator for pc. Exactly one of
+// the two peers has to be polite. signal delivers the descriptions of the
+// local peer to the remote one, which passes them to HandleDescription.
+// The PerfectNegotiator takes over the OnNegotiationNeeded handler of pc.
+func NewPerfectNegotiator(pc *PeerConnection, polite bool, signal func(SessionDescription) error) *PerfectNegotiator {
+	n := &PerfectNegotiator{
+		pc:     pc,
+		polite: polite,
+		signal: signal,
+	}
+	pc.OnNegotiationNeeded(func() {
+		if err := n.Negotiate(); err != nil {
+			n.handleError(err)
+		}
+	})
+	return n
+}
+
+// OnError sets an event handler which is invoked when a negotiation
+// started by OnNegotiationNeeded fails
+func (n *PerfectNegotiator) OnError(f func(error)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.onError = f
+}
+
+func (n *PerfectNegotiator) handleError(err error) {
+	n.mu.Lock()
+	hdlr := n.onError
+	n.mu.Unlock()
+
+	if hdlr != nil {
+		hdlr(err)
+	}
+}
+
+// Negotiate creates an offer, applies it and signals it to the remote.
+// Nothing happens while another negotiation is in progress, it is picked
+// up by OnNegotiationNeeded once signaling is stable again.
+func (n *PerfectNegotiator) Negotiate() error {
+	offer, err := n.createOffer()
+	if err != nil || offer == nil {
+		return err
+	}
+	return n.signal(*offer)
+}
+
+func (n *PerfectNegotiator) createOffer() (*SessionDescription, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.pc.SignalingState() != SignalingStateStable {
+		return nil, nil
+	}
+
+	offer, err := n.pc.CreateOffer(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = n.pc.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+	return n.pc.LocalDescription(), nil
+}
+
+// HandleDescription applies a description signaled by the remote. A
+// colliding offer is ignored by the impolite peer, the polite peer rolls
+// back its own offer and answers it.
+func (n *PerfectNegotiator) HandleDescription(desc SessionDescription) error {
+	answer, err := n.applyDescription(desc)
+	if err != nil || answer == nil {
+		return err
+	}
+	return n.signal(*answer)
+}
+
+// applyDescription applies a remote description, and returns the answer to
+// signal back if it is an offer
+func (n *PerfectNegotiator) applyDescription(desc SessionDescription) (*SessionDescription, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	offerCollision := desc.Type == SDPTypeOffer && n.pc.SignalingState() != SignalingStateStable
+	n.ignoreOffer = !n.polite && offerCollision
+	if n.ignoreOffer {
+		return nil, nil
+	}
+
+	if offerCollision {
+		if err := n.pc.SetLocalDescription(SessionDescription{Type: SDPTypeRollback}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := n.pc.SetRemoteDescription(desc); err != nil {
+		return nil, err
+	}
+	if desc.Type != SDPTypeOffer {
+		return nil, nil
+	}
+
+	answer, err := n.pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = n.pc.SetLocalDescription(answer); err != nil {
+		return nil, err
+	}
+	return n.pc.LocalDescription(), nil
+}
+
+// HandleCandidate adds a candidate trickled by the remote. Failures are
+// expected for the candidates of an offer that has been ignored, they
+// aren't reported.
+func (n *PerfectNegotiator) HandleCandidate(candidate ICECandidateInit) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.pc.AddICECandidate(candidate); err != nil && !n.ignoreOffer {
+		return err
+	}
+	return nil
+}
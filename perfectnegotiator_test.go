@@ -0,0 +1,87 @@
+// +build !js
+
+package webrtc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerfectNegotiator(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcPolite, pcImpolite, err := api.newPair()
+	assert.NoError(t, err)
+
+	// Descriptions are delivered in order, like a signaling channel would
+	errs := make(chan error, 16)
+	done := make(chan struct{})
+	var polite, impolite *PerfectNegotiator
+	deliver := func(to **PerfectNegotiator) func(SessionDescription) error {
+		descs := make(chan SessionDescription, 16)
+		go func() {
+			for {
+				select {
+				case desc := <-descs:
+					if handleErr := (*to).HandleDescription(desc); handleErr != nil {
+						errs <- handleErr
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+		return func(desc SessionDescription) error {
+			select {
+			case descs <- desc:
+			case <-done:
+			}
+			return nil
+		}
+	}
+	polite = NewPerfectNegotiator(pcPolite, true, deliver(&impolite))
+	impolite = NewPerfectNegotiator(pcImpolite, false, deliver(&polite))
+	polite.OnError(func(negotiateErr error) { errs <- negotiateErr })
+	impolite.OnError(func(negotiateErr error) { errs <- negotiateErr })
+
+	// Both sides want to negotiate at once, the offers collide
+	_, err = pcPolite.AddTransceiver(RTPCodecTypeAudio)
+	assert.NoError(t, err)
+	_, err = pcImpolite.AddTransceiver(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+
+	negotiated := func(pc *PeerConnection) bool {
+		localDesc := pc.CurrentLocalDescription()
+		if pc.SignalingState() != SignalingStateStable || localDesc == nil {
+			return false
+		}
+		for _, transceiver := range pc.GetTransceivers() {
+			if transceiver.Mid() == "" {
+				return false
+			}
+		}
+		return strings.Contains(localDesc.SDP, "m=audio") && strings.Contains(localDesc.SDP, "m=video")
+	}
+
+	for !negotiated(pcPolite) || !negotiated(pcImpolite) {
+		select {
+		case err = <-errs:
+			t.Fatal(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	close(done)
+	assert.NoError(t, pcPolite.Close())
+	assert.NoError(t, pcImpolite.Close())
+}
@@ -7,7 +7,6 @@ import (
 	"sync"
 
 	"github.com/pion/rtcp"
-	"github.com/pion/srtp"
 )
 
 // RTPReceiver allows an application to inspect the receipt of a Track
@@ -20,8 +19,8 @@ type RTPReceiver struct {
 	closed, received chan interface{}
 	mu               sync.RWMutex
 
-	rtpReadStream  *srtp.ReadStreamSRTP
-	rtcpReadStream *srtp.ReadStreamSRTCP
+	rtpReadStream  readStream
+	rtcpReadStream readStream
 
 	// A reference to the associated api object
 	api *API
@@ -50,6 +49,14 @@ func (r *RTPReceiver) Transport() *DTLSTransport {
 	return r.transport
 }
 
+// setTransport binds the receiver to the transport of its m-section, it
+// has to be called before Receive
+func (r *RTPReceiver) setTransport(transport *DTLSTransport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport = transport
+}
+
 // Track returns the RTCRtpTransceiver track
 func (r *RTPReceiver) Track() *Track {
 	r.mu.RLock()
@@ -140,6 +147,16 @@ func (r *RTPReceiver) Stop() error {
 	return nil
 }
 
+// haveReceived tells if Receive has been called for this instance
+func (r *RTPReceiver) haveReceived() bool {
+	select {
+	case <-r.received:
+		return true
+	default:
+		return false
+	}
+}
+
 // readRTP should only be called by a track, this only exists so we can keep state in one place
 func (r *RTPReceiver) readRTP(b []byte) (n int, err error) {
 	<-r.received
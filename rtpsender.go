@@ -6,15 +6,35 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
-	"github.com/pion/srtp"
 )
 
 // RTPSender allows an application to control how a given Track is encoded and transmitted to a remote peer
 type RTPSender struct {
 	track          *Track
-	rtcpReadStream *srtp.ReadStreamSRTCP
+	rtcpReadStream readStream
+
+	// The SSRC, kind and codec are those of the track the sender started
+	// with, a replacement track is sent as a continuation of it
+	ssrc  uint32
+	kind  RTPCodecType
+	codec *RTPCodec
+
+	// Set once the SSRC has been announced in a session description, from
+	// then on it is kept whatever track is sent
+	announced bool
+
+	// Set once ReplaceTrack has been called, packets are rewritten to
+	// continue the SSRC and sequence numbers sent so far
+	replaced           bool
+	resync             bool
+	sequenceOffset     uint16
+	lastSequenceNumber uint16
+
+	// paused is set while the negotiated direction doesn't allow sending
+	paused bool
 
 	transport *DTLSTransport
 
@@ -42,6 +62,9 @@ func (api *API) NewRTPSender(track *Track, transport *DTLSTransport) (*RTPSender
 
 	return &RTPSender{
 		track:      track,
+		ssrc:       track.ssrc,
+		kind:       track.kind,
+		codec:      track.codec,
 		transport:  transport,
 		api:        api,
 		sendCalled: make(chan interface{}),
@@ -57,6 +80,108 @@ func (r *RTPSender) Transport() *DTLSTransport {
 	return r.transport
 }
 
+// setTransport binds the sender to the transport of its m-section, it has
+// to be called before Send
+func (r *RTPSender) setTransport(transport *DTLSTransport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport = transport
+}
+
+// Track returns the RTPTransceiver track, or nil
+func (r *RTPSender) Track() *Track {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.track
+}
+
+// ReplaceTrack replaces the track currently being used as the sender's
+// source with a new Track, without renegotiation. The remote keeps seeing
+// the same stream: packets of the new track are sent with the SSRC of the
+// previous one and continue its sequence numbers, so once the sender has
+// been negotiated the new Track has to use the same codec. A nil Track
+// stops sending until another one is set.
+func (r *RTPSender) ReplaceTrack(track *Track) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.stopCalled:
+		return &rtcerr.InvalidStateError{Err: fmt.Errorf("RTPSender has been stopped")}
+	default:
+	}
+
+	if track != nil {
+		track.mu.RLock()
+		kind, codec, isRemote := track.kind, track.codec, track.receiver != nil
+		track.mu.RUnlock()
+
+		switch {
+		case isRemote:
+			return fmt.Errorf("RTPSender can not send a remote track")
+		case kind != r.kind:
+			return &rtcerr.TypeError{Err: fmt.Errorf("new track must be of kind %s", r.kind)}
+		case (r.hasSent() || r.announced) && !codecsMatch(codec, r.codec):
+			return &rtcerr.InvalidModificationError{Err: fmt.Errorf("new track must use the codec %s with payload type %d", r.codec.Name, r.codec.PayloadType)}
+		}
+	}
+
+	if r.track == track {
+		return nil
+	}
+
+	if r.track != nil {
+		r.track.removeSender(r)
+	}
+
+	if track != nil {
+		track.mu.Lock()
+		track.totalSenderCount++
+		if r.hasSent() {
+			track.activeSenders = append(track.activeSenders, r)
+		}
+		track.mu.Unlock()
+	}
+
+	r.track = track
+	if track != nil && !r.hasSent() && !r.announced {
+		// Nothing has been sent or negotiated yet, the track can be used
+		// as it is
+		r.ssrc = track.SSRC()
+		r.codec = track.Codec()
+		r.replaced = false
+	} else {
+		r.replaced = true
+		r.resync = true
+	}
+	return nil
+}
+
+// getSSRC returns the SSRC media is sent with
+func (r *RTPSender) getSSRC() uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ssrc
+}
+
+// announceSSRC returns the SSRC media is sent with, which is kept from
+// now on as the remote is told about it
+func (r *RTPSender) announceSSRC() uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.announced = true
+	return r.ssrc
+}
+
+// codecsMatch tells if packets of a track using codec a can continue a
+// stream that has been sent with codec b
+func codecsMatch(a, b *RTPCodec) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.ClockRate == b.ClockRate && a.PayloadType == b.PayloadType
+}
+
 // Send Attempts to set the parameters controlling the sending of media.
 func (r *RTPSender) Send(parameters RTPSendParameters) error {
 	r.mu.Lock()
@@ -66,19 +191,21 @@ func (r *RTPSender) Send(parameters RTPSendParameters) error {
 		return fmt.Errorf("Send has already been called")
 	}
 
-	srtcpSession, err := r.transport.getSRTCPSession()
+	session, err := r.transport.getSRTCPSession()
 	if err != nil {
 		return err
 	}
 
-	r.rtcpReadStream, err = srtcpSession.OpenReadStream(parameters.Encodings.SSRC)
+	r.rtcpReadStream, err = session.OpenReadStream(parameters.Encodings.SSRC)
 	if err != nil {
 		return err
 	}
 
-	r.track.mu.Lock()
-	r.track.activeSenders = append(r.track.activeSenders, r)
-	r.track.mu.Unlock()
+	if r.track != nil {
+		r.track.mu.Lock()
+		r.track.activeSenders = append(r.track.activeSenders, r)
+		r.track.mu.Unlock()
+	}
 
 	close(r.sendCalled)
 	return nil
@@ -95,17 +222,9 @@ func (r *RTPSender) Stop() error {
 	default:
 	}
 
-	r.track.mu.Lock()
-	defer r.track.mu.Unlock()
-	filtered := []*RTPSender{}
-	for _, s := range r.track.activeSenders {
-		if s != r {
-			filtered = append(filtered, s)
-		} else {
-			r.track.totalSenderCount--
-		}
+	if r.track != nil {
+		r.track.removeSender(r)
 	}
-	r.track.activeSenders = filtered
 	close(r.stopCalled)
 
 	if r.hasSent() {
@@ -138,20 +257,38 @@ func (r *RTPSender) sendRTP(header *rtp.Header, payload []byte) (int, error) {
 	case <-r.stopCalled:
 		return 0, fmt.Errorf("RTPSender has been stopped")
 	case <-r.sendCalled:
-		srtpSession, err := r.transport.getSRTPSession()
+		if r.isPaused() {
+			return len(payload), nil
+		}
+
+		session, err := r.transport.getSRTPSession()
 		if err != nil {
 			return 0, err
 		}
 
-		writeStream, err := srtpSession.OpenWriteStream()
+		writeStream, err := session.OpenWriteStream()
 		if err != nil {
 			return 0, err
 		}
 
-		return writeStream.WriteRTP(header, payload)
+		return writeStream.WriteRTP(r.rewriteHeader(header), payload)
 	}
 }
 
+// setPaused stops or resumes sending without tearing the sender down, used
+// when the negotiated direction changes
+func (r *RTPSender) setPaused(paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = paused
+}
+
+func (r *RTPSender) isPaused() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused
+}
+
 // hasSent tells if data has been ever sent for this instance
 func (r *RTPSender) hasSent() bool {
 	select {
@@ -161,3 +298,27 @@ func (r *RTPSender) hasSent() bool {
 		return false
 	}
 }
+
+// rewriteHeader makes packets of a replacement track continue the stream
+// of the first one. The header is shared with other senders of the track,
+// so it is copied before being modified.
+func (r *RTPSender) rewriteHeader(header *rtp.Header) *rtp.Header {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.replaced {
+		r.lastSequenceNumber = header.SequenceNumber
+		return header
+	}
+
+	if r.resync {
+		r.sequenceOffset = r.lastSequenceNumber + 1 - header.SequenceNumber
+		r.resync = false
+	}
+
+	rewritten := *header
+	rewritten.SSRC = r.ssrc
+	rewritten.SequenceNumber = header.SequenceNumber + r.sequenceOffset
+	r.lastSequenceNumber = rewritten.SequenceNumber
+	return &rewritten
+}
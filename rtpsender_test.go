@@ -0,0 +1,63 @@
+// +build !js
+
+package webrtc
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTPSender_ReplaceTrack(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstTrack, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "first", "pion")
+	assert.NoError(t, err)
+	secondTrack, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "second", "pion")
+	assert.NoError(t, err)
+	audioTrack, err := pc.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	assert.NoError(t, err)
+	h264Track, err := pc.NewTrack(DefaultPayloadTypeH264, rand.Uint32(), "h264", "pion")
+	assert.NoError(t, err)
+
+	sender, err := pc.api.NewRTPSender(firstTrack, pc.dtlsTransport)
+	assert.NoError(t, err)
+
+	assert.Error(t, sender.ReplaceTrack(audioTrack))
+
+	// Once negotiated the SSRC and codec are kept, even before anything
+	// has been sent
+	negotiated, err := pc.api.NewRTPSender(firstTrack, pc.dtlsTransport)
+	assert.NoError(t, err)
+	assert.Equal(t, firstTrack.SSRC(), negotiated.announceSSRC())
+
+	err = negotiated.ReplaceTrack(h264Track)
+	_, isInvalidModification := err.(*rtcerr.InvalidModificationError)
+	assert.True(t, isInvalidModification)
+
+	assert.NoError(t, negotiated.ReplaceTrack(secondTrack))
+	assert.Equal(t, firstTrack.SSRC(), negotiated.getSSRC())
+
+	// Pretend Send has been called, sending started with the first track
+	close(sender.sendCalled)
+	header := &rtp.Header{SSRC: firstTrack.SSRC(), SequenceNumber: 100}
+	assert.Equal(t, header, sender.rewriteHeader(header))
+
+	assert.NoError(t, sender.ReplaceTrack(secondTrack))
+	for i, sequenceNumber := range []uint16{5000, 5001, 5002} {
+		header = &rtp.Header{SSRC: secondTrack.SSRC(), SequenceNumber: sequenceNumber}
+		rewritten := sender.rewriteHeader(header)
+
+		assert.Equal(t, firstTrack.SSRC(), rewritten.SSRC)
+		assert.Equal(t, uint16(101+i), rewritten.SequenceNumber)
+		assert.Equal(t, secondTrack.SSRC(), header.SSRC, "shared header must not be modified")
+	}
+
+	assert.NoError(t, pc.Close())
+}
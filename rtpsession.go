@@ -0,0 +1,321 @@
+// +build !js
+
+package webrtc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/srtp"
+	"github.com/pion/transport/packetio"
+)
+
+// Limit the buffer size of plain read streams to 1MB, as pion/srtp does
+const plainRTPBufferSize = 1000 * 1000
+
+// readStream is the read side of the RTP or RTCP of a single SSRC
+type readStream interface {
+	Read(b []byte) (int, error)
+	Close() error
+}
+
+// rtpSession demultiplexes RTP by SSRC, it is SRTP protected unless
+// SettingEngine.SetInsecurePlainRTP has been called
+type rtpSession interface {
+	OpenReadStream(ssrc uint32) (readStream, error)
+	AcceptStream() (readStream, uint32, error)
+	OpenWriteStream() (rtpWriteStream, error)
+	Close() error
+}
+
+type rtpWriteStream interface {
+	WriteRTP(header *rtp.Header, payload []byte) (int, error)
+}
+
+// rtcpSession is rtpSession for RTCP
+type rtcpSession interface {
+	OpenReadStream(ssrc uint32) (readStream, error)
+	AcceptStream() (readStream, uint32, error)
+	OpenWriteStream() (rtcpWriteStream, error)
+	Close() error
+}
+
+type rtcpWriteStream interface {
+	Write(b []byte) (int, error)
+}
+
+// secureRTPSession is the rtpSession of a pion/srtp SessionSRTP
+type secureRTPSession struct {
+	*srtp.SessionSRTP
+}
+
+func (s secureRTPSession) OpenReadStream(ssrc uint32) (readStream, error) {
+	stream, err := s.SessionSRTP.OpenReadStream(ssrc)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s secureRTPSession) AcceptStream() (readStream, uint32, error) {
+	stream, ssrc, err := s.SessionSRTP.AcceptStream()
+	if err != nil {
+		return nil, 0, err
+	}
+	return stream, ssrc, nil
+}
+
+func (s secureRTPSession) OpenWriteStream() (rtpWriteStream, error) {
+	stream, err := s.SessionSRTP.OpenWriteStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// secureRTCPSession is the rtcpSession of a pion/srtp SessionSRTCP
+type secureRTCPSession struct {
+	*srtp.SessionSRTCP
+}
+
+func (s secureRTCPSession) OpenReadStream(ssrc uint32) (readStream, error) {
+	stream, err := s.SessionSRTCP.OpenReadStream(ssrc)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s secureRTCPSession) AcceptStream() (readStream, uint32, error) {
+	stream, ssrc, err := s.SessionSRTCP.AcceptStream()
+	if err != nil {
+		return nil, 0, err
+	}
+	return stream, ssrc, nil
+}
+
+func (s secureRTCPSession) OpenWriteStream() (rtcpWriteStream, error) {
+	stream, err := s.SessionSRTCP.OpenWriteStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// plainSession demultiplexes unprotected packets by the SSRCs ssrcs
+// returns for them. It is shared by plainRTPSession and plainRTCPSession.
+type plainSession struct {
+	conn  net.Conn
+	ssrcs func([]byte) ([]uint32, error)
+	log   logging.LeveledLogger
+
+	mu      sync.Mutex
+	streams map[uint32]*plainReadStream
+	closed  bool
+
+	newStream chan *plainReadStream
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newPlainSession(conn net.Conn, ssrcs func([]byte) ([]uint32, error), log logging.LeveledLogger) *plainSession {
+	s := &plainSession{
+		conn:      conn,
+		ssrcs:     ssrcs,
+		log:       log,
+		streams:   map[uint32]*plainReadStream{},
+		newStream: make(chan *plainReadStream),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+func (s *plainSession) readLoop() {
+	defer func() {
+		s.mu.Lock()
+		s.closed = true
+		for _, stream := range s.streams {
+			stream.buffer.Close() // nolint:errcheck
+		}
+		s.mu.Unlock()
+
+		close(s.newStream)
+		close(s.done)
+	}()
+
+	b := make([]byte, receiveMTU)
+	for {
+		n, err := s.conn.Read(b)
+		if err != nil {
+			if err != io.EOF {
+				s.log.Debugf("plain RTP session closed: %v", err)
+			}
+			return
+		}
+
+		ssrcs, err := s.ssrcs(b[:n])
+		if err != nil {
+			s.log.Infof("Failed to parse plain RTP/RTCP: %v", err)
+			continue
+		}
+
+		for _, ssrc := range ssrcs {
+			stream, isNew := s.getOrCreateReadStream(ssrc)
+			if stream == nil {
+				return
+			}
+			if isNew {
+				select {
+				case s.newStream <- stream:
+				case <-s.closing:
+					return
+				}
+			}
+
+			if _, err = stream.buffer.Write(b[:n]); err != nil && err != packetio.ErrFull {
+				s.log.Infof("Failed to buffer plain RTP/RTCP: %v", err)
+			}
+		}
+	}
+}
+
+func (s *plainSession) getOrCreateReadStream(ssrc uint32) (*plainReadStream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+	if stream, ok := s.streams[ssrc]; ok {
+		return stream, false
+	}
+
+	buffer := packetio.NewBuffer()
+	buffer.SetLimitSize(plainRTPBufferSize)
+	stream := &plainReadStream{session: s, ssrc: ssrc, buffer: buffer}
+	s.streams[ssrc] = stream
+	return stream, true
+}
+
+func (s *plainSession) removeReadStream(ssrc uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, ssrc)
+}
+
+// OpenReadStream returns the stream of an SSRC without waiting for
+// AcceptStream
+func (s *plainSession) OpenReadStream(ssrc uint32) (readStream, error) {
+	stream, _ := s.getOrCreateReadStream(ssrc)
+	if stream == nil {
+		return nil, fmt.Errorf("plain RTP session has been closed")
+	}
+	return stream, nil
+}
+
+// AcceptStream returns the stream of the next SSRC that hasn't been seen
+// before
+func (s *plainSession) AcceptStream() (readStream, uint32, error) {
+	stream, ok := <-s.newStream
+	if !ok {
+		return nil, 0, fmt.Errorf("plain RTP session has been closed")
+	}
+	return stream, stream.ssrc, nil
+}
+
+// Close closes the underlying connection, which ends the session
+func (s *plainSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	<-s.done
+	return nil
+}
+
+type plainReadStream struct {
+	session *plainSession
+	ssrc    uint32
+	buffer  *packetio.Buffer
+}
+
+func (r *plainReadStream) Read(b []byte) (int, error) {
+	return r.buffer.Read(b)
+}
+
+func (r *plainReadStream) Close() error {
+	r.session.removeReadStream(r.ssrc)
+	return r.buffer.Close()
+}
+
+// plainRTPSession is the rtpSession used without SRTP
+type plainRTPSession struct {
+	*plainSession
+}
+
+func newPlainRTPSession(conn net.Conn, log logging.LeveledLogger) plainRTPSession {
+	return plainRTPSession{newPlainSession(conn, func(packet []byte) ([]uint32, error) {
+		header := &rtp.Header{}
+		if err := header.Unmarshal(packet); err != nil {
+			return nil, err
+		}
+		return []uint32{header.SSRC}, nil
+	}, log)}
+}
+
+func (s plainRTPSession) OpenWriteStream() (rtpWriteStream, error) {
+	return plainRTPWriteStream{s.conn}, nil
+}
+
+type plainRTPWriteStream struct {
+	conn net.Conn
+}
+
+func (w plainRTPWriteStream) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	raw, err := header.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	return w.conn.Write(append(raw, payload...))
+}
+
+// plainRTCPSession is the rtcpSession used without SRTP, packets are
+// delivered to the streams of all the SSRCs they refer to
+type plainRTCPSession struct {
+	*plainSession
+}
+
+func newPlainRTCPSession(conn net.Conn, log logging.LeveledLogger) plainRTCPSession {
+	return plainRTCPSession{newPlainSession(conn, func(packet []byte) ([]uint32, error) {
+		pkts, err := rtcp.Unmarshal(packet)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[uint32]bool{}
+		ssrcs := []uint32{}
+		for _, pkt := range pkts {
+			for _, ssrc := range pkt.DestinationSSRC() {
+				if !seen[ssrc] {
+					seen[ssrc] = true
+					ssrcs = append(ssrcs, ssrc)
+				}
+			}
+		}
+		return ssrcs, nil
+	}, log)}
+}
+
+func (s plainRTCPSession) OpenWriteStream() (rtcpWriteStream, error) {
+	return s.conn, nil
+}
@@ -4,49 +4,192 @@ package webrtc
 
 import (
 	"fmt"
+	"sync"
+
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
 )
 
 // RTPTransceiver represents a combination of an RTPSender and an RTPReceiver that share a common mid.
 type RTPTransceiver struct {
+	mu sync.RWMutex
+
+	mid string
+
 	Sender    *RTPSender
 	Receiver  *RTPReceiver
 	Direction RTPTransceiverDirection
-	// currentDirection RTPTransceiverDirection
+	// currentDirection is the direction last negotiated by an answer
+	currentDirection RTPTransceiverDirection
 	// firedDirection   RTPTransceiverDirection
 	// receptive bool
 	stopped bool
 	kind    RTPCodecType
+
+	// negotiationNeeded updates the negotiation-needed flag of the
+	// PeerConnection the transceiver belongs to
+	negotiationNeeded func()
+}
+
+// Mid returns the mid of the media section the RTPTransceiver has been
+// associated with, or an empty string if it hasn't been negotiated yet.
+func (t *RTPTransceiver) Mid() string {
+	return t.getMid()
+}
+
+func (t *RTPTransceiver) setMid(mid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mid = mid
+}
+
+func (t *RTPTransceiver) getMid() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mid
+}
+
+// getReceiver returns the Receiver, which openSRTP may create once the
+// direction has been changed to a receiving one
+func (t *RTPTransceiver) getReceiver() *RTPReceiver {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.Receiver
+}
+
+func (t *RTPTransceiver) setReceiver(receiver *RTPReceiver) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Receiver = receiver
 }
 
-func (t *RTPTransceiver) setSendingTrack(track *Track) error {
+// getDirection returns the preferred direction, which the application may
+// change with SetDirection at any time
+func (t *RTPTransceiver) getDirection() RTPTransceiverDirection {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.Direction
+}
+
+// SetDirection changes the preferred direction of the RTPTransceiver. The
+// change takes effect once it has been negotiated, use it to put media on
+// hold (sendonly/inactive) and to resume it (sendrecv) again.
+func (t *RTPTransceiver) SetDirection(direction RTPTransceiverDirection) error {
+	switch direction {
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly,
+		RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionInactive:
+	default:
+		return &rtcerr.TypeError{Err: fmt.Errorf("invalid RTPTransceiverDirection %s", direction)}
+	}
+
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return &rtcerr.InvalidStateError{Err: fmt.Errorf("RTPTransceiver has been stopped")}
+	}
+	changed := t.Direction != direction
+	t.Direction = direction
+	t.mu.Unlock()
+
+	if changed && t.negotiationNeeded != nil {
+		t.negotiationNeeded()
+	}
+	return nil
+}
+
+// CurrentDirection returns the direction negotiated by the last applied
+// answer, or Unknown if the RTPTransceiver has not been negotiated yet.
+func (t *RTPTransceiver) CurrentDirection() RTPTransceiverDirection {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.currentDirection
+}
+
+// setCurrentDirection records the negotiated direction and pauses the
+// sender while we aren't allowed to send
+func (t *RTPTransceiver) setCurrentDirection(direction RTPTransceiverDirection) {
+	t.mu.Lock()
+	t.currentDirection = direction
+	t.mu.Unlock()
+
+	t.setProvisionalDirection(direction)
+}
+
+// setProvisionalDirection pauses the sender for a direction negotiated by
+// a provisional answer, which doesn't change the currentDirection
+func (t *RTPTransceiver) setProvisionalDirection(direction RTPTransceiverDirection) {
+	if sender := t.getSender(); sender != nil {
+		sender.setPaused(!direction.sends())
+	}
+}
+
+// getSender returns the Sender, which AddTrack may create on a transceiver
+// that has been created without one
+func (t *RTPTransceiver) getSender() *RTPSender {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.Sender
+}
+
+// setSendingTrack starts sending track on a transceiver that only received
+// so far. sender, created for track, is used if the transceiver has none.
+func (t *RTPTransceiver) setSendingTrack(track *Track, sender *RTPSender) error {
 	if track == nil {
 		return fmt.Errorf("track must not be nil")
 	}
 
-	t.Sender.track = track
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	var direction RTPTransceiverDirection
 	switch t.Direction {
 	case RTPTransceiverDirectionRecvonly:
-		t.Direction = RTPTransceiverDirectionSendrecv
+		direction = RTPTransceiverDirectionSendrecv
 	case RTPTransceiverDirectionInactive:
-		t.Direction = RTPTransceiverDirectionSendonly
+		direction = RTPTransceiverDirectionSendonly
 	default:
 		return fmt.Errorf("invalid state change in RTPTransceiver.setSending")
 	}
+
+	if t.Sender == nil {
+		t.Sender = sender
+	} else if err := t.Sender.ReplaceTrack(track); err != nil {
+		return err
+	}
+	t.Direction = direction
 	return nil
 }
 
-// Stop irreversibly stops the RTPTransceiver
+// Stop irreversibly stops the RTPTransceiver. Its media section is
+// rejected by the next offer or answer, after which the RTPTransceiver is
+// removed from the PeerConnection.
 func (t *RTPTransceiver) Stop() error {
-	if t.Sender != nil {
-		if err := t.Sender.Stop(); err != nil {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	t.stopped = true
+	t.mu.Unlock()
+
+	if sender := t.getSender(); sender != nil {
+		if err := sender.Stop(); err != nil {
 			return err
 		}
 	}
-	if t.Receiver != nil {
-		if err := t.Receiver.Stop(); err != nil {
+	if receiver := t.getReceiver(); receiver != nil {
+		if err := receiver.Stop(); err != nil {
 			return err
 		}
 	}
+
+	if t.negotiationNeeded != nil {
+		t.negotiationNeeded()
+	}
 	return nil
 }
+
+func (t *RTPTransceiver) isStopped() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stopped
+}
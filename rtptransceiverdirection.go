@@ -60,3 +60,41 @@ func (t RTPTransceiverDirection) String() string {
 		return ErrUnknownType.Error()
 	}
 }
+
+func newRTPTransceiverDirectionFromSendRecv(send, recv bool) RTPTransceiverDirection {
+	switch {
+	case send && recv:
+		return RTPTransceiverDirectionSendrecv
+	case send:
+		return RTPTransceiverDirectionSendonly
+	case recv:
+		return RTPTransceiverDirectionRecvonly
+	default:
+		return RTPTransceiverDirectionInactive
+	}
+}
+
+func (t RTPTransceiverDirection) sends() bool {
+	return t == RTPTransceiverDirectionSendrecv || t == RTPTransceiverDirectionSendonly
+}
+
+func (t RTPTransceiverDirection) receives() bool {
+	return t == RTPTransceiverDirectionSendrecv || t == RTPTransceiverDirectionRecvonly
+}
+
+// reverse returns the direction as seen by the remote end
+func (t RTPTransceiverDirection) reverse() RTPTransceiverDirection {
+	switch t {
+	case RTPTransceiverDirectionSendonly:
+		return RTPTransceiverDirectionRecvonly
+	case RTPTransceiverDirectionRecvonly:
+		return RTPTransceiverDirectionSendonly
+	default:
+		return t
+	}
+}
+
+// intersect returns the direction both t and other allow
+func (t RTPTransceiverDirection) intersect(other RTPTransceiverDirection) RTPTransceiverDirection {
+	return newRTPTransceiverDirectionFromSendRecv(t.sends() && other.sends(), t.receives() && other.receives())
+}
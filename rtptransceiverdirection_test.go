@@ -47,3 +47,25 @@ func TestRTPTransceiverDirection_String(t *testing.T) {
 		)
 	}
 }
+
+func TestRTPTransceiverDirection_Intersect(t *testing.T) {
+	testCases := []struct {
+		local, remote RTPTransceiverDirection
+		expected      RTPTransceiverDirection
+	}{
+		{RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendrecv},
+		{RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly},
+		{RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendonly},
+		{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionInactive},
+		{RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly},
+		{RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionInactive, RTPTransceiverDirectionInactive},
+	}
+
+	for i, testCase := range testCases {
+		assert.Equal(t,
+			testCase.expected,
+			testCase.local.intersect(testCase.remote.reverse()),
+			"testCase: %d %v", i, testCase,
+		)
+	}
+}
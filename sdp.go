@@ -0,0 +1,443 @@
+// +build !js
+
+package webrtc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/logging"
+	"github.com/pion/sdp/v2"
+
+	"github.com/hcm007/webrtc/v2/pkg/rtcerr"
+)
+
+// mediaSection describes a single m= line of a SessionDescription we are
+// going to generate, and which transceivers (or the SCTP association) it
+// carries. direction overrides the direction of the transceivers when set,
+// answers use it to announce what both sides agreed on. remoteRejected is
+// the m= line of a remote m-line we can't carry, it is rejected with the
+// transport protocol the remote used.
+type mediaSection struct {
+	id             string
+	transceivers   []*RTPTransceiver
+	data           bool
+	remoteRejected *sdp.MediaName
+	direction      RTPTransceiverDirection
+
+	// protos is the transport protocol of the remote m-line, plain RTP
+	// answers with the profile it has been offered
+	protos []string
+}
+
+// rejected tells if the media section has to be rejected with a zero port,
+// which is the case once all of its transceivers have been stopped
+func (m mediaSection) rejected() bool {
+	if m.remoteRejected != nil {
+		return true
+	}
+	if m.data {
+		return false
+	}
+	if len(m.transceivers) == 0 {
+		return false
+	}
+	for _, t := range m.transceivers {
+		if !t.isStopped() {
+			return false
+		}
+	}
+	return true
+}
+
+// unmarshalSessionDescription parses a SessionDescription. pion/sdp
+// doesn't know the RTP/AVPF profile (RFC 4585) plain RTP m-lines use, they
+// are parsed as RTP/AVP and get their profile back afterwards.
+func unmarshalSessionDescription(raw string) (*sdp.SessionDescription, error) {
+	lines := strings.Split(raw, "\n")
+	avpf := []bool{}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "m=") {
+			continue
+		}
+		fields := strings.Fields(line)
+		isAVPF := len(fields) > 2 && strings.HasSuffix(fields[2], "/AVPF")
+		if isAVPF {
+			lines[i] = strings.Replace(line, " "+fields[2]+" ", " "+strings.TrimSuffix(fields[2], "F")+" ", 1)
+		}
+		avpf = append(avpf, isAVPF)
+	}
+
+	parsed := &sdp.SessionDescription{}
+	if err := parsed.Unmarshal([]byte(strings.Join(lines, "\n"))); err != nil {
+		return nil, err
+	}
+	for i, media := range parsed.MediaDescriptions {
+		if i < len(avpf) && avpf[i] {
+			media.MediaName.Protos[len(media.MediaName.Protos)-1] = "AVPF"
+		}
+	}
+	return parsed, nil
+}
+
+// isPlainRTPProtos tells if an m-line carries plain RTP, with either the
+// RTP/AVP or the RTP/AVPF profile
+func isPlainRTPProtos(protos []string) bool {
+	return len(protos) == 2 && protos[0] == "RTP" && (protos[1] == "AVP" || protos[1] == "AVPF")
+}
+
+// trackDetails represents any media source that can be represented in a SDP
+// This isn't keyed by SSRC because it also needs to support rid based sources
+type trackDetails struct {
+	mid   string
+	kind  RTPCodecType
+	label string
+	id    string
+	ssrc  uint32
+}
+
+// trackDetailsFromSDP extracts all the SSRCs announced by a SessionDescription
+func trackDetailsFromSDP(log logging.LeveledLogger, s *sdp.SessionDescription) map[uint32]trackDetails {
+	incomingTracks := map[uint32]trackDetails{}
+
+	for _, media := range s.MediaDescriptions {
+		// Rejected m-lines don't carry any media
+		if media.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		midValue, _ := media.Attribute(sdp.AttrKeyMID)
+		for _, attr := range media.Attributes {
+			codecType := NewRTPCodecType(media.MediaName.Media)
+			if codecType == 0 {
+				continue
+			}
+
+			if attr.Key == sdp.AttrKeySSRC {
+				split := strings.Split(attr.Value, " ")
+				ssrc, err := strconv.ParseUint(split[0], 10, 32)
+				if err != nil {
+					log.Warnf("Failed to parse SSRC: %v", err)
+					continue
+				}
+
+				trackID := ""
+				trackLabel := ""
+				if len(split) == 3 && strings.HasPrefix(split[1], "msid:") {
+					trackLabel = split[1][len("msid:"):]
+					trackID = split[2]
+				}
+
+				incomingTracks[uint32(ssrc)] = trackDetails{midValue, codecType, trackLabel, trackID, uint32(ssrc)}
+				if trackID != "" && trackLabel != "" {
+					break // Remote provided Label+ID, we have all the information we need
+				}
+			}
+		}
+	}
+
+	return incomingTracks
+}
+
+// nextMidValue returns the smallest numeric mid that isn't in use yet
+func nextMidValue(used map[string]bool) string {
+	for i := 0; ; i++ {
+		if mid := strconv.Itoa(i); !used[mid] {
+			used[mid] = true
+			return mid
+		}
+	}
+}
+
+// extractICEDetails returns the ICE credentials and the candidates a
+// SessionDescription carries
+func extractICEDetails(desc *sdp.SessionDescription) (ufrag string, pwd string, candidates []ICECandidate, err error) {
+	ufrag, _ = desc.Attribute("ice-ufrag")
+	pwd, _ = desc.Attribute("ice-pwd")
+
+	for _, m := range desc.MediaDescriptions {
+		mediaUfrag, mediaPwd, mediaCandidates, err := extractMediaICEDetails(m)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		if mediaUfrag != "" {
+			ufrag = mediaUfrag
+		}
+		if mediaPwd != "" {
+			pwd = mediaPwd
+		}
+		candidates = append(candidates, mediaCandidates...)
+	}
+
+	return ufrag, pwd, candidates, nil
+}
+
+// extractBundleTransportICEDetails is extractICEDetails for a
+// SessionDescription that isn't bundled, only the media section returned by
+// bundleTransportMidFromSDP is taken into account
+func extractBundleTransportICEDetails(desc *sdp.SessionDescription) (ufrag string, pwd string, candidates []ICECandidate, err error) {
+	ufrag, _ = desc.Attribute("ice-ufrag")
+	pwd, _ = desc.Attribute("ice-pwd")
+
+	bundleMid := bundleTransportMidFromSDP(desc)
+	for _, m := range desc.MediaDescriptions {
+		if midValue, _ := m.Attribute(sdp.AttrKeyMID); midValue != bundleMid {
+			continue
+		}
+
+		mediaUfrag, mediaPwd, mediaCandidates, err := extractMediaICEDetails(m)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		if mediaUfrag != "" {
+			ufrag = mediaUfrag
+		}
+		if mediaPwd != "" {
+			pwd = mediaPwd
+		}
+		candidates = append(candidates, mediaCandidates...)
+	}
+
+	return ufrag, pwd, candidates, nil
+}
+
+// extractMediaICEDetails returns the ICE credentials and the candidates of
+// a single media section, without the ones set at the session level
+func extractMediaICEDetails(m *sdp.MediaDescription) (ufrag string, pwd string, candidates []ICECandidate, err error) {
+	for _, a := range m.Attributes {
+		switch {
+		case a.IsICECandidate():
+			sdpCandidate, err := a.ToICECandidate()
+			if err != nil {
+				return "", "", nil, err
+			}
+
+			candidate, err := newICECandidateFromSDP(sdpCandidate)
+			if err != nil {
+				return "", "", nil, err
+			}
+
+			candidates = append(candidates, candidate)
+		case strings.HasPrefix(*a.String(), "ice-ufrag"):
+			ufrag = (*a.String())[len("ice-ufrag:"):]
+		case strings.HasPrefix(*a.String(), "ice-pwd"):
+			pwd = (*a.String())[len("ice-pwd:"):]
+		}
+	}
+
+	return ufrag, pwd, candidates, nil
+}
+
+// candidateMediaIndex returns the index of the media section a trickled
+// candidate refers to, by its SDPMid or else its SDPMLineIndex. It is
+// negative when the candidate refers to none.
+func candidateMediaIndex(desc *sdp.SessionDescription, candidate ICECandidateInit) (int, error) {
+	switch {
+	case candidate.SDPMid != nil && *candidate.SDPMid != "":
+		for i, m := range desc.MediaDescriptions {
+			if midValue, _ := m.Attribute(sdp.AttrKeyMID); midValue == *candidate.SDPMid {
+				return i, nil
+			}
+		}
+		return 0, &rtcerr.OperationError{Err: ErrCandidateMediaNotFound}
+	case candidate.SDPMLineIndex != nil:
+		if int(*candidate.SDPMLineIndex) >= len(desc.MediaDescriptions) {
+			return 0, &rtcerr.OperationError{Err: ErrCandidateMediaNotFound}
+		}
+		return int(*candidate.SDPMLineIndex), nil
+	}
+	return -1, nil
+}
+
+// mediaHasAttribute tells if a media section carries an attribute
+func mediaHasAttribute(m *sdp.MediaDescription, key, value string) bool {
+	for _, a := range m.Attributes {
+		if a.Key == key && a.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleTransportCandidatesComplete tells if the remote signaled the end of
+// the candidates of the m-section returned by bundleTransportMidFromSDP
+func bundleTransportCandidatesComplete(desc *sdp.SessionDescription) bool {
+	bundleMid := bundleTransportMidFromSDP(desc)
+	for _, m := range desc.MediaDescriptions {
+		if midValue, _ := m.Attribute(sdp.AttrKeyMID); midValue == bundleMid {
+			return mediaHasAttribute(m, "end-of-candidates", "")
+		}
+	}
+	return false
+}
+
+// addMediaAttributeLines returns raw with the attribute appended to the
+// m-sections at mediaIndexes, the other lines are left as they are
+func addMediaAttributeLines(raw string, mediaIndexes map[int]bool, attribute sdp.Attribute) string {
+	lineEnding := "\n"
+	if strings.Contains(raw, "\r\n") {
+		lineEnding = "\r\n"
+	}
+
+	var b strings.Builder
+	mediaIndex := -1
+	appendAttribute := func() {
+		if !mediaIndexes[mediaIndex] {
+			return
+		}
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString(lineEnding)
+		}
+		b.WriteString("a=" + *attribute.String() + lineEnding)
+	}
+	for _, line := range strings.SplitAfter(raw, "\n") {
+		if strings.HasPrefix(line, "m=") {
+			appendAttribute()
+			mediaIndex++
+		}
+		b.WriteString(line)
+	}
+	appendAttribute()
+	return b.String()
+}
+
+// descriptionIsICELite tells if the agent that created a SessionDescription
+// is a lite one
+func descriptionIsICELite(desc *sdp.SessionDescription) bool {
+	_, ok := desc.Attribute("ice-lite")
+	return ok
+}
+
+// descriptionIsBundled tells if a SessionDescription groups its media
+// sections with BUNDLE
+func descriptionIsBundled(desc *sdp.SessionDescription) bool {
+	group, ok := desc.Attribute(sdp.AttrKeyGroup)
+	return ok && strings.HasPrefix(group, "BUNDLE")
+}
+
+// bundleTransportMid returns the mid of the media section that uses the
+// transports of the PeerConnection itself when the session isn't bundled.
+// That is the application section, so the SCTP association can always run
+// there, or the first media section that hasn't been rejected.
+func bundleTransportMid(mediaSections []mediaSection) string {
+	for _, m := range mediaSections {
+		if m.data && !m.rejected() {
+			return m.id
+		}
+	}
+	for _, m := range mediaSections {
+		if !m.rejected() {
+			return m.id
+		}
+	}
+	return ""
+}
+
+// unbundledMids returns the m-sections of an initial offer that get a
+// transport of their own, in case the answer rejects BUNDLE. max-compat
+// gives one to every m-section, balanced to the first one of every media
+// type, whose other m-sections are stopped then.
+func unbundledMids(policy BundlePolicy, mediaSections []mediaSection) map[string]bool {
+	mids := map[string]bool{}
+	seenKinds := map[RTPCodecType]bool{}
+	for _, m := range mediaSections {
+		if m.data || m.rejected() {
+			continue
+		}
+
+		switch policy {
+		case BundlePolicyMaxCompat:
+			mids[m.id] = true
+		case BundlePolicyBalanced:
+			if kind := m.transceivers[0].kind; !seenKinds[kind] {
+				seenKinds[kind] = true
+				mids[m.id] = true
+			}
+		}
+	}
+	return mids
+}
+
+// bundleTransportMidFromSDP is bundleTransportMid for a parsed
+// SessionDescription
+func bundleTransportMidFromSDP(desc *sdp.SessionDescription) string {
+	for _, m := range desc.MediaDescriptions {
+		if m.MediaName.Media == "application" && m.MediaName.Port.Value != 0 {
+			midValue, _ := m.Attribute(sdp.AttrKeyMID)
+			return midValue
+		}
+	}
+	for _, m := range desc.MediaDescriptions {
+		if m.MediaName.Port.Value != 0 {
+			midValue, _ := m.Attribute(sdp.AttrKeyMID)
+			return midValue
+		}
+	}
+	return ""
+}
+
+// extractFingerprints returns all the DTLS fingerprints a
+// SessionDescription carries, at the session and at the media level
+func extractFingerprints(desc *sdp.SessionDescription) []DTLSFingerprint {
+	fingerprints := []DTLSFingerprint{}
+	addFingerprint := func(value string) {
+		parts := strings.Split(value, " ")
+		if len(parts) != 2 {
+			return
+		}
+		for _, f := range fingerprints {
+			if strings.EqualFold(f.Algorithm, parts[0]) && strings.EqualFold(f.Value, parts[1]) {
+				return
+			}
+		}
+		fingerprints = append(fingerprints, DTLSFingerprint{Algorithm: parts[0], Value: parts[1]})
+	}
+
+	for _, a := range desc.Attributes {
+		if a.Key == "fingerprint" {
+			addFingerprint(a.Value)
+		}
+	}
+	for _, m := range desc.MediaDescriptions {
+		for _, a := range m.Attributes {
+			if a.Key == "fingerprint" {
+				addFingerprint(a.Value)
+			}
+		}
+	}
+	return fingerprints
+}
+
+// extractMediaFingerprints returns the DTLS fingerprints that apply to a
+// media section, its own or else the ones set at the session level
+func extractMediaFingerprints(desc *sdp.SessionDescription, m *sdp.MediaDescription) ([]DTLSFingerprint, error) {
+	values := []string{}
+	for _, a := range m.Attributes {
+		if a.Key == "fingerprint" {
+			values = append(values, a.Value)
+		}
+	}
+	if len(values) == 0 {
+		for _, a := range desc.Attributes {
+			if a.Key == "fingerprint" {
+				values = append(values, a.Value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("could not find fingerprint")
+	}
+
+	fingerprints := []DTLSFingerprint{}
+	for _, value := range values {
+		parts := strings.Split(value, " ")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid fingerprint")
+		}
+		fingerprints = append(fingerprints, DTLSFingerprint{Algorithm: parts[0], Value: parts[1]})
+	}
+	return fingerprints, nil
+}
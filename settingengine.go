@@ -3,6 +3,7 @@
 package webrtc
 
 import (
+	"crypto/x509"
 	"time"
 
 	"github.com/hcm007/ice"
@@ -30,10 +31,16 @@ type SettingEngine struct {
 		ICERelayAcceptanceMinWait    *time.Duration
 	}
 	candidates struct {
+		ICELite         bool
 		ICETrickle      bool
 		ICENetworkTypes []NetworkType
 	}
-	LoggerFactory logging.LoggerFactory
+	answeringDTLSRole         DTLSRole
+	srtpProtectionProfiles    []SRTPProtectionProfile
+	dtlsVerifyPeerCertificate func(*x509.Certificate) error
+	insecurePlainRTP          bool
+	identityProviders         map[string]IdentityProvider
+	LoggerFactory             logging.LoggerFactory
 }
 
 // DetachDataChannels enables detaching data channels. When enabled
@@ -94,8 +101,75 @@ func (e *SettingEngine) SetTrickle(trickle bool) {
 	e.candidates.ICETrickle = trickle
 }
 
+// SetLite configures whether or not the ice agent should be a lite agent.
+// A lite agent only gathers host candidates, never initiates connectivity
+// checks and is always controlled, unless the remote is lite as well.
+func (e *SettingEngine) SetLite(lite bool) {
+	e.candidates.ICELite = lite
+}
+
+// SetAnsweringDTLSRole sets the DTLS role taken when answering an offer
+// that leaves the choice to the answerer. DTLSRoleClient, the default,
+// answers a=setup:active and DTLSRoleServer answers a=setup:passive.
+func (e *SettingEngine) SetAnsweringDTLSRole(role DTLSRole) error {
+	if role != DTLSRoleClient && role != DTLSRoleServer {
+		return ErrInvalidAnsweringDTLSRole
+	}
+
+	e.answeringDTLSRole = role
+	return nil
+}
+
+// SetSRTPProtectionProfiles sets the SRTP protection profiles offered in
+// the DTLS use_srtp extension, in order of preference. The SRTP and SRTCP
+// sessions are keyed with the one the handshake selects.
+func (e *SettingEngine) SetSRTPProtectionProfiles(profiles ...SRTPProtectionProfile) error {
+	if len(profiles) == 0 {
+		return ErrNoSRTPProtectionProfile
+	}
+	for _, profile := range profiles {
+		if !supportedSRTPProtectionProfiles[profile] {
+			return ErrUnsupportedSRTPProtectionProfile
+		}
+	}
+
+	e.srtpProtectionProfiles = append([]SRTPProtectionProfile{}, profiles...)
+	return nil
+}
+
+// SetDTLSVerifyPeerCertificate sets a function that verifies the remote
+// certificate once it matched the fingerprints of the remote description,
+// which allows pinning certificates. The DTLSTransport fails with the error
+// it returns.
+func (e *SettingEngine) SetDTLSVerifyPeerCertificate(verify func(remoteCertificate *x509.Certificate) error) {
+	e.dtlsVerifyPeerCertificate = verify
+}
+
+// SetInsecurePlainRTP negotiates RTP/AVPF instead of UDP/TLS/RTP/SAVPF and
+// sends and receives media as plain RTP and RTCP, without DTLS or SRTP.
+// Remote offers may use RTP/AVP as well, they are answered with the same
+// profile.
+// ICE is still used to select the candidate pair. Data channels can't be
+// used as they need DTLS.
+//
+// INSECURE: media isn't encrypted or authenticated. This is only meant for
+// lab and interop testing, never enable it in production.
+func (e *SettingEngine) SetInsecurePlainRTP(enabled bool) {
+	e.insecurePlainRTP = enabled
+}
+
 // SetNetworkTypes configures what types of candidate networks are supported
 // during local and server reflexive gathering.
 func (e *SettingEngine) SetNetworkTypes(candidateTypes []NetworkType) {
 	e.candidates.ICENetworkTypes = candidateTypes
 }
+
+// AddIdentityProvider registers the IdentityProvider of domain. It validates
+// the identity assertions of remote peers naming domain, and asserts the
+// local identity once selected with PeerConnection.SetIdentityProvider.
+func (e *SettingEngine) AddIdentityProvider(domain string, provider IdentityProvider) {
+	if e.identityProviders == nil {
+		e.identityProviders = map[string]IdentityProvider{}
+	}
+	e.identityProviders[domain] = provider
+}
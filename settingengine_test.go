@@ -61,3 +61,72 @@ func TestDetachDataChannels(t *testing.T) {
 		t.Fatalf("Failed to enable detached data channels.")
 	}
 }
+
+func TestSetAnsweringDTLSRole(t *testing.T) {
+	s := SettingEngine{}
+
+	if err := s.SetAnsweringDTLSRole(DTLSRoleAuto); err == nil {
+		t.Fatalf("SetAnsweringDTLSRole can only be called with DTLSRoleClient or DTLSRoleServer")
+	}
+
+	if err := s.SetAnsweringDTLSRole(DTLSRoleServer); err != nil {
+		t.Fatalf("SetAnsweringDTLSRole failed: %s", err)
+	}
+
+	if s.answeringDTLSRole != DTLSRoleServer {
+		t.Fatalf("Setting engine does not reflect requested value.")
+	}
+}
+
+func TestSetSRTPProtectionProfiles(t *testing.T) {
+	s := SettingEngine{}
+
+	if s.srtpProtectionProfiles != nil {
+		t.Fatalf("SettingEngine defaults aren't as expected.")
+	}
+
+	if err := s.SetSRTPProtectionProfiles(); err == nil {
+		t.Fatalf("SetSRTPProtectionProfiles should fail without profiles")
+	}
+
+	if err := s.SetSRTPProtectionProfiles(SRTPProtectionProfile(0xffff)); err == nil {
+		t.Fatalf("SetSRTPProtectionProfiles should fail with an unsupported profile")
+	}
+
+	if err := s.SetSRTPProtectionProfiles(SRTPProtectionProfileAES128CMHMACSHA180); err != nil {
+		t.Fatalf("SetSRTPProtectionProfiles failed: %s", err)
+	}
+
+	if len(s.srtpProtectionProfiles) != 1 ||
+		s.srtpProtectionProfiles[0] != SRTPProtectionProfileAES128CMHMACSHA180 {
+		t.Fatalf("Setting engine does not reflect requested value.")
+	}
+}
+
+func TestSetInsecurePlainRTP(t *testing.T) {
+	s := SettingEngine{}
+
+	if s.insecurePlainRTP {
+		t.Fatalf("SettingEngine defaults aren't as expected.")
+	}
+
+	s.SetInsecurePlainRTP(true)
+
+	if !s.insecurePlainRTP {
+		t.Fatalf("Setting engine does not reflect requested value.")
+	}
+}
+
+func TestSetLite(t *testing.T) {
+	s := SettingEngine{}
+
+	if s.candidates.ICELite {
+		t.Fatalf("SettingEngine defaults aren't as expected.")
+	}
+
+	s.SetLite(true)
+
+	if !s.candidates.ICELite {
+		t.Fatalf("Setting engine does not reflect requested value.")
+	}
+}
@@ -111,6 +111,22 @@ func checkNextSignalingState(cur, next SignalingState, op stateChangeOp, sdpType
 		}
 	}
 
+	// have-local-offer->SetLocal(rollback)->stable
+	// have-remote-pranswer->SetLocal(rollback)->stable
+	// have-remote-offer->SetRemote(rollback)->stable
+	// have-local-pranswer->SetRemote(rollback)->stable
+	// Each side rolls back the offer it has applied itself
+	if sdpType == SDPTypeRollback && next == SignalingStateStable {
+		switch {
+		case op == stateChangeOpSetLocal &&
+			(cur == SignalingStateHaveLocalOffer || cur == SignalingStateHaveRemotePranswer):
+			return next, nil
+		case op == stateChangeOpSetRemote &&
+			(cur == SignalingStateHaveRemoteOffer || cur == SignalingStateHaveLocalPranswer):
+			return next, nil
+		}
+	}
+
 	// 4.3.1 valid state transitions
 	switch cur {
 	case SignalingStateStable:
@@ -142,10 +158,18 @@ func checkNextSignalingState(cur, next SignalingState, op stateChangeOp, sdpType
 			}
 		}
 	case SignalingStateHaveRemotePranswer:
-		if op == stateChangeOpSetRemote && sdpType == SDPTypeAnswer {
+		if op == stateChangeOpSetRemote {
+			switch sdpType {
 			// have-remote-pranswer->SetRemote(answer)->stable
-			if next == SignalingStateStable {
-				return next, nil
+			case SDPTypeAnswer:
+				if next == SignalingStateStable {
+					return next, nil
+				}
+			// have-remote-pranswer->SetRemote(pranswer)->have-remote-pranswer
+			case SDPTypePranswer:
+				if next == SignalingStateHaveRemotePranswer {
+					return next, nil
+				}
 			}
 		}
 	case SignalingStateHaveRemoteOffer:
@@ -164,10 +188,18 @@ func checkNextSignalingState(cur, next SignalingState, op stateChangeOp, sdpType
 			}
 		}
 	case SignalingStateHaveLocalPranswer:
-		if op == stateChangeOpSetLocal && sdpType == SDPTypeAnswer {
+		if op == stateChangeOpSetLocal {
+			switch sdpType {
 			// have-local-pranswer->SetLocal(answer)->stable
-			if next == SignalingStateStable {
-				return next, nil
+			case SDPTypeAnswer:
+				if next == SignalingStateStable {
+					return next, nil
+				}
+			// have-local-pranswer->SetLocal(pranswer)->have-local-pranswer
+			case SDPTypePranswer:
+				if next == SignalingStateHaveLocalPranswer {
+					return next, nil
+				}
 			}
 		}
 	}
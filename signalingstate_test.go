@@ -103,6 +103,14 @@ func TestSignalingState_Transitions(t *testing.T) {
 			SDPTypeAnswer,
 			nil,
 		},
+		{
+			"have-remote-pranswer->SetRemote(pranswer)->have-remote-pranswer",
+			SignalingStateHaveRemotePranswer,
+			SignalingStateHaveRemotePranswer,
+			stateChangeOpSetRemote,
+			SDPTypePranswer,
+			nil,
+		},
 		{
 			"have-remote-offer->SetLocal(answer)->stable",
 			SignalingStateHaveRemoteOffer,
@@ -127,6 +135,70 @@ func TestSignalingState_Transitions(t *testing.T) {
 			SDPTypeAnswer,
 			nil,
 		},
+		{
+			"have-local-pranswer->SetLocal(pranswer)->have-local-pranswer",
+			SignalingStateHaveLocalPranswer,
+			SignalingStateHaveLocalPranswer,
+			stateChangeOpSetLocal,
+			SDPTypePranswer,
+			nil,
+		},
+		{
+			"have-local-offer->SetLocal(rollback)->stable",
+			SignalingStateHaveLocalOffer,
+			SignalingStateStable,
+			stateChangeOpSetLocal,
+			SDPTypeRollback,
+			nil,
+		},
+		{
+			"have-remote-offer->SetRemote(rollback)->stable",
+			SignalingStateHaveRemoteOffer,
+			SignalingStateStable,
+			stateChangeOpSetRemote,
+			SDPTypeRollback,
+			nil,
+		},
+		{
+			"have-remote-pranswer->SetLocal(rollback)->stable",
+			SignalingStateHaveRemotePranswer,
+			SignalingStateStable,
+			stateChangeOpSetLocal,
+			SDPTypeRollback,
+			nil,
+		},
+		{
+			"have-local-pranswer->SetRemote(rollback)->stable",
+			SignalingStateHaveLocalPranswer,
+			SignalingStateStable,
+			stateChangeOpSetRemote,
+			SDPTypeRollback,
+			nil,
+		},
+		{
+			"(invalid) have-remote-offer->SetLocal(rollback)->stable",
+			SignalingStateHaveRemoteOffer,
+			SignalingStateStable,
+			stateChangeOpSetLocal,
+			SDPTypeRollback,
+			&rtcerr.InvalidModificationError{},
+		},
+		{
+			"(invalid) have-local-offer->SetRemote(rollback)->stable",
+			SignalingStateHaveLocalOffer,
+			SignalingStateStable,
+			stateChangeOpSetRemote,
+			SDPTypeRollback,
+			&rtcerr.InvalidModificationError{},
+		},
+		{
+			"(invalid) have-local-pranswer->SetLocal(rollback)->stable",
+			SignalingStateHaveLocalPranswer,
+			SignalingStateStable,
+			stateChangeOpSetLocal,
+			SDPTypeRollback,
+			&rtcerr.InvalidModificationError{},
+		},
 		{
 			"(invalid) stable->SetRemote(pranswer)->have-remote-pranswer",
 			SignalingStateStable,
@@ -0,0 +1,46 @@
+// +build !js
+
+package webrtc
+
+import (
+	"github.com/pion/dtls"
+	"github.com/pion/srtp"
+)
+
+// SRTPProtectionProfile is an SRTP protection profile negotiated with the
+// DTLS use_srtp extension. The values are the ones IANA assigned.
+// https://www.iana.org/assignments/srtp-protection/srtp-protection.xhtml
+type SRTPProtectionProfile uint16
+
+// SRTPProtectionProfileAES128CMHMACSHA180 is SRTP_AES128_CM_HMAC_SHA1_80
+// https://tools.ietf.org/html/rfc5764#section-4.1.2
+const SRTPProtectionProfileAES128CMHMACSHA180 SRTPProtectionProfile = 0x0001
+
+// supportedSRTPProtectionProfiles are the profiles both pion/dtls and
+// pion/srtp implement
+var supportedSRTPProtectionProfiles = map[SRTPProtectionProfile]bool{
+	SRTPProtectionProfileAES128CMHMACSHA180: true,
+}
+
+// defaultSRTPProtectionProfiles are offered when the SettingEngine doesn't
+// set any, in order of preference
+func defaultSRTPProtectionProfiles() []SRTPProtectionProfile {
+	return []SRTPProtectionProfile{SRTPProtectionProfileAES128CMHMACSHA180}
+}
+
+func (p SRTPProtectionProfile) String() string {
+	switch p {
+	case SRTPProtectionProfileAES128CMHMACSHA180:
+		return "SRTP_AES128_CM_HMAC_SHA1_80"
+	default:
+		return unknownStr
+	}
+}
+
+func (p SRTPProtectionProfile) dtlsProfile() dtls.SRTPProtectionProfile {
+	return dtls.SRTPProtectionProfile(p)
+}
+
+func (p SRTPProtectionProfile) srtpProfile() srtp.ProtectionProfile {
+	return srtp.ProtectionProfile(p)
+}
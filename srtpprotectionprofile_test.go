@@ -0,0 +1,35 @@
+// +build !js
+
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSRTPProtectionProfile_String(t *testing.T) {
+	testCases := []struct {
+		profile        SRTPProtectionProfile
+		expectedString string
+	}{
+		{SRTPProtectionProfile(Unknown), unknownStr},
+		{SRTPProtectionProfileAES128CMHMACSHA180, "SRTP_AES128_CM_HMAC_SHA1_80"},
+	}
+
+	for i, testCase := range testCases {
+		assert.Equal(t,
+			testCase.expectedString,
+			testCase.profile.String(),
+			"testCase: %d %v", i, testCase,
+		)
+	}
+}
+
+func TestDefaultSRTPProtectionProfiles(t *testing.T) {
+	profiles := defaultSRTPProtectionProfiles()
+	assert.NotEmpty(t, profiles)
+	for _, profile := range profiles {
+		assert.True(t, supportedSRTPProtectionProfiles[profile], "%s isn't supported", profile)
+	}
+}
@@ -185,6 +185,21 @@ func NewTrack(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec)
 	}, nil
 }
 
+// removeSender detaches a sender that stopped or switched to another track
+func (t *Track) removeSender(sender *RTPSender) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	filtered := []*RTPSender{}
+	for _, s := range t.activeSenders {
+		if s != sender {
+			filtered = append(filtered, s)
+		}
+	}
+	t.activeSenders = filtered
+	t.totalSenderCount--
+}
+
 // determinePayloadType blocks and reads a single packet to determine the PayloadType for this Track
 // this is useful if we are dealing with a remote track and we can't announce it to the user until we know the payloadType
 func (t *Track) determinePayloadType() error {